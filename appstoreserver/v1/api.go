@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -29,13 +30,11 @@ func (c *Client) GetTransactionHistory(ctx context.Context, req *TransactionHist
 	if c.Verifier.environment == EnvironmentLocalTesting || !c.Verifier.enableAutoDecode {
 		return &response, nil
 	}
-	for _, v := range response.SignedTransactions {
-		payload, err := c.Verifier.VerifyAndDecodeSignedTransaction(v)
-		if err != nil {
-			return nil, fmt.Errorf("SignedTransactions %s\nfailed to verify and decode: %w", v, err)
-		}
-		response.Payloads = append(response.Payloads, payload)
+	payloads, decodeErrors, err := c.decodeTransactions(ctx, response.SignedTransactions)
+	if err != nil {
+		return nil, err
 	}
+	response.Payloads, response.DecodeErrors = payloads, decodeErrors
 
 	return &response, nil
 }
@@ -92,18 +91,24 @@ func (c *Client) GetAllSubscriptionStatuses(ctx context.Context, transactionID s
 		return &response, nil
 	}
 
+	var items []BatchItem
 	for _, data := range response.Data {
-		for i, v := range data.LastTransactions {
-			renewalPayload, err := c.Verifier.VerifyAndDecodeRenewalInfo(v.SignedRenewalInfo)
-			if err != nil {
-				return nil, fmt.Errorf("SignedRenewalInfo %s\nfailed to verify and decode: %w", v.SignedRenewalInfo, err)
-			}
-			data.LastTransactions[i].RenewalPayload = renewalPayload
-			transactionPayload, err := c.Verifier.VerifyAndDecodeSignedTransaction(v.SignedTransactionInfo)
-			if err != nil {
-				return nil, fmt.Errorf("SignedTransactionInfo %s\nfailed to verify and decode: %w", v.SignedTransactionInfo, err)
-			}
-			data.LastTransactions[i].TransactionPayload = transactionPayload
+		for _, v := range data.LastTransactions {
+			items = append(items,
+				BatchItem{Type: SignedDataTypeRenewalInfo, SignedData: v.SignedRenewalInfo},
+				BatchItem{Type: SignedDataTypeTransaction, SignedData: v.SignedTransactionInfo},
+			)
+		}
+	}
+	results, err := c.Verifier.VerifyBatch(ctx, items, WithBatchFailFast())
+	if err != nil {
+		return nil, batchError("SignedTransactionInfo", items, results, err)
+	}
+	for _, data := range response.Data {
+		for i := range data.LastTransactions {
+			data.LastTransactions[i].RenewalPayload = results[0].RenewalInfo
+			data.LastTransactions[i].TransactionPayload = results[1].Transaction
+			results = results[2:]
 		}
 	}
 
@@ -150,13 +155,11 @@ func (c *Client) LookUpOrderID(ctx context.Context, orderID string) (*OrderLooku
 		return &response, nil
 	}
 
-	for _, v := range response.SignedTransactions {
-		payload, err := c.Verifier.VerifyAndDecodeSignedTransaction(v)
-		if err != nil {
-			return nil, fmt.Errorf("SignedTransactions %s\nfailed to verify and decode: %w", v, err)
-		}
-		response.Payloads = append(response.Payloads, payload)
+	payloads, decodeErrors, err := c.decodeTransactions(ctx, response.SignedTransactions)
+	if err != nil {
+		return nil, err
 	}
+	response.Payloads, response.DecodeErrors = payloads, decodeErrors
 
 	return &response, nil
 }
@@ -184,13 +187,11 @@ func (c *Client) GetRefundHistory(ctx context.Context, transactionID, revision s
 		return &response, nil
 	}
 
-	for _, v := range response.SignedTransactions {
-		payload, err := c.Verifier.VerifyAndDecodeSignedTransaction(v)
-		if err != nil {
-			return nil, fmt.Errorf("SignedTransactions %s\nfailed to verify and decode: %w", v, err)
-		}
-		response.Payloads = append(response.Payloads, payload)
+	payloads, decodeErrors, err := c.decodeTransactions(ctx, response.SignedTransactions)
+	if err != nil {
+		return nil, err
 	}
+	response.Payloads, response.DecodeErrors = payloads, decodeErrors
 
 	return &response, nil
 }
@@ -323,59 +324,168 @@ func (c *Client) GetTestNotificationStatus(ctx context.Context, testNotification
 	return &response, nil
 }
 
-// makereq performs an HTTP req to the App Store Server API
-func (c *Client) makeRequest(ctx context.Context, method, path string, queryParams url.Values, requestBody, responseBody any) error {
-	token, err := c.TokenGenerator.GenerateToken()
-	if err != nil {
-		return fmt.Errorf("failed to generate JWT token: %w", err)
+// decodeTransactions verifies and decodes signedTransactions concurrently according to the decode policy,
+// the strict policy fails on the first invalid transaction while the others report them as DecodeErrors
+func (c *Client) decodeTransactions(ctx context.Context, signedTransactions []string) ([]*JWSTransactionDecodedPayload, []*DecodeError, error) {
+	items := make([]BatchItem, len(signedTransactions))
+	for i, v := range signedTransactions {
+		items[i] = BatchItem{Type: SignedDataTypeTransaction, SignedData: v}
+	}
+
+	policy := c.Verifier.decodePolicy
+	var options []BatchOption
+	if policy == DecodePolicyStrict {
+		options = append(options, WithBatchFailFast())
+	}
+	results, err := c.Verifier.VerifyBatch(ctx, items, options...)
+	if err != nil && policy == DecodePolicyStrict {
+		return nil, nil, batchError("SignedTransactions", items, results, err)
+	}
+	// A canceled ctx isn't a property of the transactions
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		payloads     []*JWSTransactionDecodedPayload
+		decodeErrors []*DecodeError
+	)
+	for i, result := range results {
+		if result.Err != nil {
+			decodeErrors = append(decodeErrors, &DecodeError{Index: i, SignedData: items[i].SignedData, Err: result.Err})
+			if policy == DecodePolicySkipInvalid {
+				continue
+			}
+		}
+		payloads = append(payloads, result.Transaction)
 	}
+	return payloads, decodeErrors, nil
+}
+
+// batchError returns the error of the first invalid item of a failed VerifyBatch,
+// transactionField names the field signed transactions are read from
+func batchError(transactionField string, items []BatchItem, results []BatchResult, err error) error {
+	for i, result := range results {
+		if result.Err == nil || errors.Is(result.Err, ErrBatchAborted) {
+			continue
+		}
+		field := transactionField
+		if items[i].Type == SignedDataTypeRenewalInfo {
+			field = "SignedRenewalInfo"
+		}
+		return fmt.Errorf("%s %s\nfailed to verify and decode: %w", field, items[i].SignedData, result.Err)
+	}
+	return err
+}
 
+// makereq performs an HTTP req to the App Store Server API, retrying according to the retry policy
+func (c *Client) makeRequest(ctx context.Context, method, path string, queryParams url.Values, requestBody, responseBody any) error {
 	fullURL := c.baseURL + path
 	if len(queryParams) > 0 {
 		fullURL += "?" + queryParams.Encode()
 	}
 
-	var bodyReader io.Reader
+	var bodyBytes []byte
 	if requestBody != nil {
-		bodyBytes, err := json.Marshal(requestBody)
+		var err error
+		bodyBytes, err = json.Marshal(requestBody)
 		if err != nil {
 			return fmt.Errorf("failed to marshal req body: %w", err)
 		}
+	}
+
+	maxRetries := 0
+	if c.retryPolicy != nil && c.retryPolicy.allowsMethod(method) {
+		maxRetries = c.retryPolicy.MaxRetries
+	}
+
+	var tokenRefreshed bool
+	for attempt := 0; ; attempt++ {
+		respBodyBytes, err := c.doRequest(ctx, method, fullURL, bodyBytes)
+		if err == nil {
+			if responseBody != nil {
+				if err := json.Unmarshal(respBodyBytes, responseBody); err != nil {
+					return fmt.Errorf("failed to unmarshal response body: %w", err)
+				}
+			}
+			return nil
+		}
+
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.HTTPStatus == http.StatusUnauthorized && !tokenRefreshed {
+			// The request was rejected before processing, retry once with a freshly signed token
+			c.TokenGenerator.InvalidateToken()
+			tokenRefreshed = true
+			attempt--
+			continue
+		}
+
+		if attempt >= maxRetries || ctx.Err() != nil {
+			return err
+		}
+
+		var (
+			delay    = c.retryPolicy.backoff(attempt)
+			retrying bool
+		)
+		switch {
+		case apiErr != nil:
+			retrying = apiErr.IsRetryable()
+			if apiErr.IsRateLimited() && apiErr.RetryAfter > 0 {
+				// Give up rather than blocking for as long as the server asks, the caller gets RetryAfter
+				if apiErr.RetryAfter > c.retryPolicy.maxBackoff() {
+					return err
+				}
+				delay = apiErr.RetryAfter
+			}
+		default:
+			retrying = isTransientError(err)
+		}
+
+		if !retrying || !sleepContext(ctx, delay) {
+			return err
+		}
+	}
+}
+
+// doRequest performs a single HTTP attempt and returns the response body
+func (c *Client) doRequest(ctx context.Context, method, fullURL string, bodyBytes []byte) ([]byte, error) {
+	token, err := c.TokenGenerator.GenerateToken()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate JWT token: %w", err)
+	}
+
+	var bodyReader io.Reader
+	if bodyBytes != nil {
 		bodyReader = bytes.NewReader(bodyBytes)
 	}
 
 	req, err := http.NewRequestWithContext(ctx, method, fullURL, bodyReader)
 	if err != nil {
-		return fmt.Errorf("failed to create HTTP request: %w", err)
+		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
 	}
 
 	req.Header.Set("User-Agent", c.userAgent)
 	req.Header.Set("Authorization", "Bearer "+token)
 	req.Header.Set("Accept", "application/json")
-	if requestBody != nil {
+	if bodyBytes != nil {
 		req.Header.Set("Content-Type", "application/json")
 	}
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("HTTP req failed: %w", err)
+		return nil, fmt.Errorf("HTTP req failed: %w", err)
 	}
 	defer resp.Body.Close()
 
 	respBodyBytes, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return fmt.Errorf("failed to read response body: %w", err)
+		return nil, fmt.Errorf("failed to read response body: %w", err)
 	}
 
 	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
-		return NewAPIErrorFromResponse(resp, respBodyBytes)
-	}
-
-	if responseBody != nil {
-		if err := json.Unmarshal(respBodyBytes, responseBody); err != nil {
-			return fmt.Errorf("failed to unmarshal response body: %w", err)
-		}
+		return nil, NewAPIErrorFromResponse(resp, respBodyBytes)
 	}
 
-	return nil
+	return respBodyBytes, nil
 }
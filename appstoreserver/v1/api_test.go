@@ -481,3 +481,61 @@ func TestAPITooManyRequestsException(t *testing.T) {
 		t.Fatalf("expected error code %d but got %d", 4290000, apiErr.ErrorCode)
 	}
 }
+
+func TestBaseURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []Option
+		want    string
+	}{
+		{"environment default", nil, LocalTestingBaseURL + "/inApps/v1/transactions/1234"},
+		{"base URL", []Option{WithBaseURL("http://proxy.internal:8080/appstore/")}, "http://proxy.internal:8080/appstore/inApps/v1/transactions/1234"},
+		{"environment base URL", []Option{
+			WithEnvironmentBaseURL(EnvironmentSandbox, "https://sandbox.proxy.internal"),
+			WithEnvironmentBaseURL(EnvironmentLocalTesting, "http://127.0.0.1:9000"),
+		}, "http://127.0.0.1:9000/inApps/v1/transactions/1234"},
+		{"base URL takes precedence", []Option{
+			WithEnvironmentBaseURL(EnvironmentLocalTesting, "http://127.0.0.1:9000"),
+			WithBaseURL("http://127.0.0.1:9001"),
+		}, "http://127.0.0.1:9001/inApps/v1/transactions/1234"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requested string
+			client, err := mockClientWithHandler(func(req *http.Request) (*http.Response, error) {
+				requested = req.URL.String()
+				return mockResponse(http.StatusOK, nil, "models/transactionInfoResponse.json")
+			}, tt.options...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := client.GetTransactionInfo(context.Background(), "1234"); err != nil {
+				t.Fatal(err)
+			}
+			if requested != tt.want {
+				t.Fatalf("expected %q, got %q", tt.want, requested)
+			}
+		})
+	}
+}
+
+func TestInvalidBaseURL(t *testing.T) {
+	for _, option := range []Option{
+		WithBaseURL("proxy.internal"),
+		WithBaseURL("ftp://proxy.internal"),
+		WithBaseURL("https://proxy.internal?env=sandbox"),
+		WithEnvironmentBaseURL(EnvironmentSandbox, "/relative"),
+	} {
+		if _, err := mockTestClient(option); err == nil {
+			t.Fatal("expected error but got nil")
+		}
+	}
+}
+
+func TestInvalidDecodePolicy(t *testing.T) {
+	if _, err := mockTestClient(WithDecodePolicy(DecodePolicy(42))); err == nil {
+		t.Fatal("expected error but got nil")
+	}
+}
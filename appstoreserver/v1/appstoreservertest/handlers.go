@@ -0,0 +1,625 @@
+package appstoreservertest
+
+import (
+	"bytes"
+	"cmp"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	appstoreserver "github.com/gh73962/appleapis/appstoreserver/v1"
+	"github.com/gh73962/appleapis/appstoreservernotifications/v2"
+)
+
+// transaction is a seeded signed transaction with its decoded payload
+type transaction struct {
+	signed  string
+	payload appstoreserver.JWSTransactionDecodedPayload
+}
+
+// notification is a seeded notification history item with its decoded payload
+type notification struct {
+	item          appstoreserver.NotificationHistoryResponseItem
+	payload       appstoreservernotifications.DecodedPayload
+	transactionID string
+}
+
+// SeedTransactions adds the signed transactions of one customer, returned by the transaction history,
+// transaction info and refund history endpoints for any of their transaction identifiers
+func (s *Server) SeedTransactions(signedTransactions ...string) error {
+	customer := make([]*transaction, 0, len(signedTransactions))
+	for _, signed := range signedTransactions {
+		t := transaction{signed: signed}
+		if err := decodePayload(signed, &t.payload); err != nil {
+			return err
+		}
+		customer = append(customer, &t)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.customers = append(s.customers, customer)
+	return nil
+}
+
+// SeedStatus sets the status returned by the subscription status endpoint for the original transaction of signedTransactionInfo
+func (s *Server) SeedStatus(status appstoreserver.SubscriptionStatus, signedTransactionInfo, signedRenewalInfo string) error {
+	var payload appstoreserver.JWSTransactionDecodedPayload
+	if err := decodePayload(signedTransactionInfo, &payload); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.statuses[payload.OriginalTransactionID] = &appstoreserver.LastTransactionsItem{
+		Status:                status,
+		OriginalTransactionID: payload.OriginalTransactionID,
+		SignedTransactionInfo: signedTransactionInfo,
+		SignedRenewalInfo:     signedRenewalInfo,
+		TransactionPayload:    &payload,
+	}
+	return nil
+}
+
+// SeedOrder sets the signed transactions returned by the order lookup endpoint for orderID
+func (s *Server) SeedOrder(orderID string, signedTransactions ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.orders[orderID] = signedTransactions
+}
+
+// SeedNotifications adds items returned by the notification history endpoint
+func (s *Server) SeedNotifications(items ...appstoreserver.NotificationHistoryResponseItem) error {
+	seeded := make([]*notification, 0, len(items))
+	for _, item := range items {
+		n := notification{item: item}
+		if err := decodePayload(item.SignedPayload, &n.payload); err != nil {
+			return err
+		}
+		if n.payload.Data != nil && n.payload.Data.SignedTransactionInfo != "" {
+			var payload appstoreserver.JWSTransactionDecodedPayload
+			if err := decodePayload(n.payload.Data.SignedTransactionInfo, &payload); err != nil {
+				return err
+			}
+			n.transactionID = payload.TransactionID
+		}
+		seeded = append(seeded, &n)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.notifications = append(s.notifications, seeded...)
+	slices.SortStableFunc(s.notifications, func(a, b *notification) int {
+		return cmp.Compare(a.payload.SignedDate, b.payload.SignedDate)
+	})
+	return nil
+}
+
+// AppAccountToken returns the app account token set for originalTransactionID
+func (s *Server) AppAccountToken(originalTransactionID string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.appAccountTokens[originalTransactionID]
+}
+
+// ConsumptionRequest returns the consumption information sent for transactionID
+func (s *Server) ConsumptionRequest(transactionID string) (appstoreserver.ConsumptionRequest, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	req, ok := s.consumption[transactionID]
+	return req, ok
+}
+
+// Extensions returns the renewal date extension requests received by the server
+func (s *Server) Extensions() []appstoreserver.ExtendRenewalDateRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]appstoreserver.ExtendRenewalDateRequest(nil), s.extensions...)
+}
+
+func (s *Server) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /inApps/v2/history/{transactionId}", s.handleTransactionHistory)
+	mux.HandleFunc("GET /inApps/v1/transactions/{transactionId}", s.handleTransactionInfo)
+	mux.HandleFunc("PUT /inApps/v1/transactions/{first}/{second}", s.handleTransactionUpdate)
+	mux.HandleFunc("GET /inApps/v1/subscriptions/{transactionId}", s.handleSubscriptionStatuses)
+	mux.HandleFunc("GET /inApps/v1/lookup/{orderId}", s.handleOrderLookup)
+	mux.HandleFunc("GET /inApps/v2/refund/lookup/{transactionId}", s.handleRefundHistory)
+	mux.HandleFunc("PUT /inApps/v1/subscriptions/extend/{originalTransactionId}", s.handleExtendRenewalDate)
+	mux.HandleFunc("POST /inApps/v1/subscriptions/extend/mass", s.handleMassExtendRenewalDate)
+	mux.HandleFunc("GET /inApps/v1/subscriptions/extend/mass/{productId}/{requestIdentifier}", s.handleMassExtendRenewalDateStatus)
+	mux.HandleFunc("POST /inApps/v1/notifications/history", s.handleNotificationHistory)
+	mux.HandleFunc("POST /inApps/v1/notifications/test", s.handleRequestTestNotification)
+	mux.HandleFunc("GET /inApps/v1/notifications/test/{testNotificationToken}", s.handleTestNotificationStatus)
+	return s.middleware(mux)
+}
+
+// customerOf returns the transactions of the customer owning transactionID, the caller must hold s.mu
+func (s *Server) customerOf(transactionID string) []*transaction {
+	for _, customer := range s.customers {
+		for _, t := range customer {
+			if t.payload.TransactionID == transactionID || t.payload.OriginalTransactionID == transactionID {
+				return customer
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Server) handleTransactionHistory(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	customer := s.customerOf(r.PathValue("transactionId"))
+	s.mu.Unlock()
+	if customer == nil {
+		writeError(w, http.StatusNotFound, appstoreserver.ErrTransactionIDNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	filtered, err := filterTransactions(customer, query)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, appstoreserver.ErrGeneralBadRequest)
+		return
+	}
+	slices.SortStableFunc(filtered, func(a, b *transaction) int {
+		return cmp.Compare(a.payload.PurchaseDate, b.payload.PurchaseDate)
+	})
+	if query.Get("sort") == "DESCENDING" {
+		slices.Reverse(filtered)
+	}
+
+	items, revision, hasMore, err := paginate(filtered, query.Get("revision"), s.pageSize)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, appstoreserver.ErrInvalidRequestRevision)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, appstoreserver.HistoryResponse{
+		Revision:           revision,
+		HasMore:            hasMore,
+		BundleID:           s.bundleID,
+		AppAppleID:         int(s.appAppleID),
+		Environment:        s.environment,
+		SignedTransactions: signedTransactions(items),
+	})
+}
+
+// filterTransactions applies the transaction history query filters
+func filterTransactions(customer []*transaction, query map[string][]string) ([]*transaction, error) {
+	var startDate, endDate int64
+	for key, dst := range map[string]*int64{"startDate": &startDate, "endDate": &endDate} {
+		if values := query[key]; len(values) > 0 {
+			value, err := strconv.ParseInt(values[0], 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			*dst = value
+		}
+	}
+	first := func(key string) string {
+		if values := query[key]; len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+
+	var filtered []*transaction
+	for _, t := range customer {
+		p := t.payload
+		switch {
+		case len(query["productId"]) > 0 && !slices.Contains(query["productId"], p.ProductID),
+			len(query["productType"]) > 0 && !slices.Contains(query["productType"], string(p.Type)),
+			len(query["subscriptionGroupIdentifier"]) > 0 && !slices.Contains(query["subscriptionGroupIdentifier"], p.SubscriptionGroupIdentifier),
+			first("inAppOwnershipType") != "" && first("inAppOwnershipType") != string(p.InAppOwnershipType),
+			first("revoked") == "true" && p.RevocationDate == 0,
+			first("revoked") == "false" && p.RevocationDate != 0,
+			startDate != 0 && p.PurchaseDate < startDate,
+			endDate != 0 && p.PurchaseDate >= endDate:
+			continue
+		}
+		filtered = append(filtered, t)
+	}
+	return filtered, nil
+}
+
+func (s *Server) handleTransactionInfo(w http.ResponseWriter, r *http.Request) {
+	transactionID := r.PathValue("transactionId")
+
+	s.mu.Lock()
+	customer := s.customerOf(transactionID)
+	s.mu.Unlock()
+
+	for _, t := range customer {
+		if t.payload.TransactionID == transactionID {
+			writeJSON(w, http.StatusOK, appstoreserver.TransactionInfoResponse{SignedTransactionInfo: t.signed})
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, appstoreserver.ErrTransactionIDNotFound)
+}
+
+// handleTransactionUpdate serves the app account token and consumption endpoints, which share a path shape
+func (s *Server) handleTransactionUpdate(w http.ResponseWriter, r *http.Request) {
+	first, second := r.PathValue("first"), r.PathValue("second")
+
+	switch {
+	case first == "consumption":
+		var req appstoreserver.ConsumptionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, appstoreserver.ErrGeneralBadRequest)
+			return
+		}
+		req.TransactionID = second
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.customerOf(second) == nil {
+			writeError(w, http.StatusNotFound, appstoreserver.ErrTransactionIDNotFound)
+			return
+		}
+		s.consumption[second] = req
+		w.WriteHeader(http.StatusAccepted)
+
+	case second == "appAccountToken":
+		var req appstoreserver.UpdateAppAccountTokenRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, appstoreserver.ErrGeneralBadRequest)
+			return
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.customerOf(first) == nil && s.statuses[first] == nil {
+			writeError(w, http.StatusNotFound, appstoreserver.ErrOriginalTransactionIDNotFound)
+			return
+		}
+		s.appAccountTokens[first] = req.AppAccountToken
+		w.WriteHeader(http.StatusOK)
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) handleSubscriptionStatuses(w http.ResponseWriter, r *http.Request) {
+	transactionID := r.PathValue("transactionId")
+
+	s.mu.Lock()
+	originalTransactionIDs := []string{transactionID}
+	for _, t := range s.customerOf(transactionID) {
+		originalTransactionIDs = append(originalTransactionIDs, t.payload.OriginalTransactionID)
+	}
+	var items []*appstoreserver.LastTransactionsItem
+	for id, item := range s.statuses {
+		if slices.Contains(originalTransactionIDs, id) {
+			items = append(items, item)
+		}
+	}
+	s.mu.Unlock()
+
+	if len(items) == 0 {
+		writeError(w, http.StatusNotFound, appstoreserver.ErrTransactionIDNotFound)
+		return
+	}
+	slices.SortFunc(items, func(a, b *appstoreserver.LastTransactionsItem) int {
+		return strings.Compare(a.OriginalTransactionID, b.OriginalTransactionID)
+	})
+
+	statusFilter := r.URL.Query()["status"]
+	response := appstoreserver.StatusResponse{
+		Environment: s.environment,
+		BundleID:    s.bundleID,
+		AppAppleID:  s.appAppleID,
+	}
+	for _, item := range items {
+		if len(statusFilter) > 0 && !slices.Contains(statusFilter, item.Status.String()) {
+			continue
+		}
+
+		groupIdentifier := item.TransactionPayload.SubscriptionGroupIdentifier
+		i := slices.IndexFunc(response.Data, func(group appstoreserver.SubscriptionGroupIdentifierItem) bool {
+			return group.SubscriptionGroupIdentifier == groupIdentifier
+		})
+		if i < 0 {
+			response.Data = append(response.Data, appstoreserver.SubscriptionGroupIdentifierItem{SubscriptionGroupIdentifier: groupIdentifier})
+			i = len(response.Data) - 1
+		}
+		response.Data[i].LastTransactions = append(response.Data[i].LastTransactions, *item)
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (s *Server) handleOrderLookup(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	signedTransactions, ok := s.orders[r.PathValue("orderId")]
+	s.mu.Unlock()
+
+	response := appstoreserver.OrderLookupResponse{Status: appstoreserver.OrderLookupStatusValid, SignedTransactions: signedTransactions}
+	if !ok {
+		response = appstoreserver.OrderLookupResponse{Status: appstoreserver.OrderLookupStatusInvalid, SignedTransactions: []string{}}
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (s *Server) handleRefundHistory(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	customer := s.customerOf(r.PathValue("transactionId"))
+	s.mu.Unlock()
+	if customer == nil {
+		writeError(w, http.StatusNotFound, appstoreserver.ErrTransactionIDNotFound)
+		return
+	}
+
+	var refunded []*transaction
+	for _, t := range customer {
+		if t.payload.RevocationDate != 0 {
+			refunded = append(refunded, t)
+		}
+	}
+	slices.SortStableFunc(refunded, func(a, b *transaction) int {
+		return cmp.Compare(a.payload.RevocationDate, b.payload.RevocationDate)
+	})
+
+	items, revision, hasMore, err := paginate(refunded, r.URL.Query().Get("revision"), s.pageSize)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, appstoreserver.ErrInvalidRequestRevision)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, appstoreserver.RefundHistoryResponse{
+		SignedTransactions: signedTransactions(items),
+		Revision:           revision,
+		HasMore:            hasMore,
+	})
+}
+
+func (s *Server) handleExtendRenewalDate(w http.ResponseWriter, r *http.Request) {
+	var req appstoreserver.ExtendRenewalDateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, appstoreserver.ErrGeneralBadRequest)
+		return
+	}
+	req.OriginalTransactionID = r.PathValue("originalTransactionId")
+
+	s.mu.Lock()
+	item, ok := s.statuses[req.OriginalTransactionID]
+	if ok {
+		s.extensions = append(s.extensions, req)
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		writeError(w, http.StatusNotFound, appstoreserver.ErrOriginalTransactionIDNotFound)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, appstoreserver.ExtendRenewalDateResponse{
+		OriginalTransactionID: req.OriginalTransactionID,
+		WebOrderLineItemID:    item.TransactionPayload.WebOrderLineItemID,
+		Success:               true,
+		EffectiveDate:         item.TransactionPayload.ExpiresDate + int64(req.ExtendByDays)*24*time.Hour.Milliseconds(),
+	})
+}
+
+func (s *Server) handleMassExtendRenewalDate(w http.ResponseWriter, r *http.Request) {
+	var req appstoreserver.MassExtendRenewalDateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, appstoreserver.ErrGeneralBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	s.massExtensions[req.ProductID+"/"+req.RequestIdentifier] = req
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, appstoreserver.MassExtendRenewalDateResponse{RequestIdentifier: req.RequestIdentifier})
+}
+
+func (s *Server) handleMassExtendRenewalDateStatus(w http.ResponseWriter, r *http.Request) {
+	productID, requestIdentifier := r.PathValue("productId"), r.PathValue("requestIdentifier")
+
+	s.mu.Lock()
+	_, ok := s.massExtensions[productID+"/"+requestIdentifier]
+	var succeeded int
+	for _, item := range s.statuses {
+		if item.TransactionPayload.ProductID == productID && item.Status == appstoreserver.StatusActive {
+			succeeded++
+		}
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		writeError(w, http.StatusNotFound, appstoreserver.ErrStatusRequestNotFound)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, appstoreserver.MassExtendRenewalDateStatusResponse{
+		RequestIdentifier: requestIdentifier,
+		Complete:          true,
+		CompleteDate:      time.Now().UnixMilli(),
+		SucceededCount:    succeeded,
+	})
+}
+
+func (s *Server) handleNotificationHistory(w http.ResponseWriter, r *http.Request) {
+	var req appstoreserver.NotificationHistoryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, appstoreserver.ErrGeneralBadRequest)
+		return
+	}
+	switch {
+	case req.StartDate < time.Now().Add(-appstoreserver.NotificationHistoryWindow).UnixMilli():
+		writeError(w, http.StatusBadRequest, appstoreserver.ErrStartDateTooFarInPast)
+		return
+	case req.EndDate <= req.StartDate:
+		writeError(w, http.StatusBadRequest, appstoreserver.ErrStartDateAfterEndDate)
+		return
+	}
+
+	s.mu.Lock()
+	var transactionIDs []string
+	if req.TransactionID != "" {
+		for _, t := range s.customerOf(req.TransactionID) {
+			transactionIDs = append(transactionIDs, t.payload.TransactionID)
+		}
+	}
+	var matched []*notification
+	for _, n := range s.notifications {
+		p := n.payload
+		switch {
+		case p.SignedDate < req.StartDate || p.SignedDate > req.EndDate,
+			req.NotificationType != "" && p.NotificationType != req.NotificationType,
+			req.NotificationSubtype != "" && p.Subtype != req.NotificationSubtype,
+			req.OnlyFailures && delivered(n.item.SendAttempts),
+			req.TransactionID != "" && !slices.Contains(transactionIDs, n.transactionID):
+			continue
+		}
+		matched = append(matched, n)
+	}
+	s.mu.Unlock()
+
+	items, paginationToken, hasMore, err := paginate(matched, r.URL.Query().Get("paginationToken"), s.pageSize)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, appstoreserver.ErrInvalidPaginationToken)
+		return
+	}
+
+	response := appstoreserver.NotificationHistoryResponse{HasMore: hasMore, NotificationHistory: []appstoreserver.NotificationHistoryResponseItem{}}
+	if hasMore {
+		response.PaginationToken = paginationToken
+	}
+	for _, n := range items {
+		response.NotificationHistory = append(response.NotificationHistory, n.item)
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// delivered reports whether the last send attempt succeeded
+func delivered(attempts []appstoreserver.SendAttemptItem) bool {
+	return len(attempts) > 0 && attempts[len(attempts)-1].SendAttemptResult == appstoreserver.SendAttemptResultSuccess
+}
+
+func (s *Server) handleRequestTestNotification(w http.ResponseWriter, r *http.Request) {
+	tokenBytes := make([]byte, 16)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		writeError(w, http.StatusInternalServerError, appstoreserver.ErrGeneralInternal)
+		return
+	}
+	token := hex.EncodeToString(tokenBytes)
+
+	signedPayload, err := s.sign(jwt.MapClaims{
+		"notificationType": appstoreservernotifications.TypeTest,
+		"notificationUUID": token,
+		"version":          "2.0",
+		"signedDate":       time.Now().UnixMilli(),
+		"data": map[string]any{
+			"bundleId":    s.bundleID,
+			"appAppleId":  s.appAppleID,
+			"environment": s.environment,
+		},
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, appstoreserver.ErrGeneralInternal)
+		return
+	}
+
+	s.mu.Lock()
+	s.testNotifications[token] = signedPayload
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, appstoreserver.SendTestNotificationResponse{TestNotificationToken: token})
+}
+
+func (s *Server) handleTestNotificationStatus(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	signedPayload, ok := s.testNotifications[r.PathValue("testNotificationToken")]
+	s.mu.Unlock()
+
+	if !ok {
+		writeError(w, http.StatusNotFound, appstoreserver.ErrTestNotificationNotFound)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, appstoreserver.CheckTestNotificationResponse{
+		SignedPayload: signedPayload,
+		SendAttempts: []appstoreserver.SendAttemptItem{
+			{AttemptDate: time.Now().UnixMilli(), SendAttemptResult: appstoreserver.SendAttemptResultSuccess},
+		},
+	})
+}
+
+// sign signs claims with the server's signer
+func (s *Server) sign(claims jwt.MapClaims) (string, error) {
+	return s.signer.Sign(claims)
+}
+
+// paginate returns the page of items starting at the offset encoded in token and the token of the next page
+func paginate[T any](items []T, token string, pageSize int) ([]T, string, bool, error) {
+	offset := 0
+	if token != "" {
+		decoded, err := base64.RawURLEncoding.DecodeString(token)
+		if err != nil {
+			return nil, "", false, err
+		}
+		offset, err = strconv.Atoi(string(decoded))
+		if err != nil || offset < 0 {
+			return nil, "", false, errors.New("invalid token")
+		}
+	}
+	if offset > len(items) {
+		offset = len(items)
+	}
+
+	end := min(offset+pageSize, len(items))
+	next := base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(end)))
+	return items[offset:end], next, end < len(items), nil
+}
+
+func signedTransactions(items []*transaction) []string {
+	signed := make([]string, 0, len(items))
+	for _, t := range items {
+		signed = append(signed, t.signed)
+	}
+	return signed
+}
+
+// decodePayload decodes the payload of a JWS without verifying it
+func decodePayload(signed string, v any) error {
+	parts := strings.Split(signed, ".")
+	if len(parts) != 3 {
+		return errors.New("signed data is not a JWS")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return fmt.Errorf("failed to decode JWS payload: %w", err)
+	}
+	if err := json.Unmarshal(payload, v); err != nil {
+		return fmt.Errorf("failed to parse JWS payload: %w", err)
+	}
+	return nil
+}
+
+// readBody reads the request body and replaces it so handlers can read it again
+func readBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil {
+		return nil, nil
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
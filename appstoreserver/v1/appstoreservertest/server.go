@@ -0,0 +1,322 @@
+// Package appstoreservertest provides an in-process fake App Store Server API for integration tests
+package appstoreservertest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	appstoreserver "github.com/gh73962/appleapis/appstoreserver/v1"
+)
+
+const (
+	// DefaultKeyID is the key identifier of the server's generated API key
+	DefaultKeyID = "testKeyId"
+	// DefaultIssuerID is the issuer identifier of the server's generated API key
+	DefaultIssuerID = "testIssuerId"
+	// DefaultBundleID is the bundle identifier the server expects in bearer tokens
+	DefaultBundleID = "com.example"
+	// DefaultPageSize is the number of items in every page of paginated responses
+	DefaultPageSize = 20
+)
+
+// Option is a function type for configuring Server
+type Option func(*Server)
+
+// WithCredentials sets the API key the server checks bearer tokens against,
+// by default the server generates a key exposed by PrivateKeyPEM
+func WithCredentials(privateKeyPEM []byte, keyID, issuerID, bundleID string) Option {
+	return func(s *Server) {
+		s.privateKeyPEM = privateKeyPEM
+		s.keyID = keyID
+		s.issuerID = issuerID
+		s.bundleID = bundleID
+	}
+}
+
+// WithEnvironment sets the environment reported in responses, EnvironmentLocalTesting by default
+func WithEnvironment(val appstoreserver.Environment) Option {
+	return func(s *Server) {
+		s.environment = val
+	}
+}
+
+// WithAppAppleID sets the app Apple ID reported in responses
+func WithAppAppleID(val int64) Option {
+	return func(s *Server) {
+		s.appAppleID = val
+	}
+}
+
+// WithSigner sets the signer of transactions and notifications created by the server,
+// by default the server generates one exposed by Signer
+func WithSigner(val *Signer) Option {
+	return func(s *Server) {
+		s.signer = val
+	}
+}
+
+// WithPageSize sets the number of items in every page of paginated responses
+func WithPageSize(val int) Option {
+	return func(s *Server) {
+		s.pageSize = val
+	}
+}
+
+// Fault is an error response the server returns instead of handling a request
+type Fault struct {
+	StatusCode int
+	ErrorCode  appstoreserver.APIErrorCode
+	// RetryAfter sets the Retry-After header when positive
+	RetryAfter time.Duration
+}
+
+// Request records a request received by the server
+type Request struct {
+	Method string
+	Path   string
+	Query  url.Values
+	Body   []byte
+}
+
+// Server is a fake App Store Server API backed by httptest.Server.
+// Requests must carry a bearer token signed with the server's API key, and responses
+// are built from the seeded transactions, statuses, orders and notifications.
+type Server struct {
+	*httptest.Server
+
+	privateKeyPEM []byte
+	publicKey     *ecdsa.PublicKey
+	keyID         string
+	issuerID      string
+	bundleID      string
+	environment   appstoreserver.Environment
+	appAppleID    int64
+	pageSize      int
+
+	signer *Signer
+
+	mu                sync.Mutex
+	faults            []Fault
+	requests          []Request
+	customers         [][]*transaction
+	statuses          map[string]*appstoreserver.LastTransactionsItem
+	orders            map[string][]string
+	notifications     []*notification
+	testNotifications map[string]string
+	appAccountTokens  map[string]string
+	consumption       map[string]appstoreserver.ConsumptionRequest
+	extensions        []appstoreserver.ExtendRenewalDateRequest
+	massExtensions    map[string]appstoreserver.MassExtendRenewalDateRequest
+}
+
+// NewServer starts a new Server, it should be closed with Close
+func NewServer(options ...Option) (*Server, error) {
+	s := Server{
+		keyID:             DefaultKeyID,
+		issuerID:          DefaultIssuerID,
+		bundleID:          DefaultBundleID,
+		environment:       appstoreserver.EnvironmentLocalTesting,
+		pageSize:          DefaultPageSize,
+		statuses:          make(map[string]*appstoreserver.LastTransactionsItem),
+		orders:            make(map[string][]string),
+		testNotifications: make(map[string]string),
+		appAccountTokens:  make(map[string]string),
+		consumption:       make(map[string]appstoreserver.ConsumptionRequest),
+		massExtensions:    make(map[string]appstoreserver.MassExtendRenewalDateRequest),
+	}
+	for _, option := range options {
+		option(&s)
+	}
+
+	if s.privateKeyPEM == nil {
+		privateKeyPEM, err := generatePrivateKeyPEM()
+		if err != nil {
+			return nil, err
+		}
+		s.privateKeyPEM = privateKeyPEM
+	}
+	privateKey, err := appstoreserver.ParsePrivateKeyFromPEM(s.privateKeyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+	s.publicKey = &privateKey.PublicKey
+
+	if s.signer == nil {
+		if s.signer, err = NewSigner(); err != nil {
+			return nil, err
+		}
+	}
+
+	s.Server = httptest.NewServer(s.routes())
+	return &s, nil
+}
+
+// PrivateKeyPEM returns the PEM encoded API key the server checks bearer tokens against
+func (s *Server) PrivateKeyPEM() []byte {
+	return s.privateKeyPEM
+}
+
+// Signer returns the signer of transactions and notifications created by the server,
+// seeded data should be signed with it to verify in the Sandbox and Production environments
+func (s *Server) Signer() *Signer {
+	return s.signer
+}
+
+// ClientOptions returns options configuring a Client to send its requests to the server
+// with the server's API key. Options passed after them take precedence.
+func (s *Server) ClientOptions() []appstoreserver.Option {
+	return []appstoreserver.Option{
+		appstoreserver.WithPrivateKey(s.privateKeyPEM),
+		appstoreserver.WithKeyID(s.keyID),
+		appstoreserver.WithIssuerID(s.issuerID),
+		appstoreserver.WithBundleID(s.bundleID),
+		appstoreserver.WithEnvironment(s.environment),
+		appstoreserver.WithAppAppleID(s.appAppleID),
+		appstoreserver.WithRootCertificates([][]byte{s.signer.RootCertificate()}),
+		appstoreserver.WithBaseURL(s.URL),
+		appstoreserver.WithHTTPClient(s.Client()),
+	}
+}
+
+// InjectFault makes the next times requests fail with fault
+func (s *Server) InjectFault(fault Fault, times int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for range times {
+		s.faults = append(s.faults, fault)
+	}
+}
+
+// InjectRateLimit makes the next times requests fail with HTTP 429 and the given Retry-After
+func (s *Server) InjectRateLimit(times int, retryAfter time.Duration) {
+	s.InjectFault(Fault{
+		StatusCode: http.StatusTooManyRequests,
+		ErrorCode:  appstoreserver.ErrRateLimitExceeded,
+		RetryAfter: retryAfter,
+	}, times)
+}
+
+// InjectServerError makes the next times requests fail with the given HTTP 5xx status
+func (s *Server) InjectServerError(times int, statusCode int) {
+	s.InjectFault(Fault{
+		StatusCode: statusCode,
+		ErrorCode:  appstoreserver.ErrGeneralInternalRetryable,
+	}, times)
+}
+
+// Requests returns the requests received by the server, including rejected ones
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// authenticate checks the bearer token of r against the server's API key
+func (s *Server) authenticate(r *http.Request) error {
+	tokenString, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return errors.New("missing bearer token")
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (any, error) {
+		if token.Header["kid"] != s.keyID {
+			return nil, fmt.Errorf("unexpected key identifier %v", token.Header["kid"])
+		}
+		return s.publicKey, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodES256.Alg()}),
+		jwt.WithAudience("appstoreconnect-v1"),
+		jwt.WithIssuer(s.issuerID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+	if err != nil {
+		return err
+	}
+
+	if claims["bid"] != s.bundleID {
+		return fmt.Errorf("unexpected bundle identifier %v", claims["bid"])
+	}
+	issuedAt, _ := claims.GetIssuedAt()
+	expiresAt, _ := claims.GetExpirationTime()
+	if issuedAt == nil || expiresAt.Sub(issuedAt.Time) > appstoreserver.MaxTokenLifetime {
+		return errors.New("token lifetime exceeds the maximum")
+	}
+	return nil
+}
+
+// middleware records requests, checks authentication and injects faults
+func (s *Server) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := readBody(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, appstoreserver.ErrGeneralBadRequest)
+			return
+		}
+
+		s.mu.Lock()
+		s.requests = append(s.requests, Request{Method: r.Method, Path: r.URL.Path, Query: r.URL.Query(), Body: body})
+		s.mu.Unlock()
+
+		if err := s.authenticate(r); err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		s.mu.Lock()
+		var fault *Fault
+		if len(s.faults) > 0 {
+			fault = &s.faults[0]
+			s.faults = s.faults[1:]
+		}
+		s.mu.Unlock()
+
+		if fault != nil {
+			if fault.RetryAfter > 0 {
+				w.Header().Set("Retry-After", strconv.Itoa(int((fault.RetryAfter+time.Second-1)/time.Second)))
+			}
+			writeError(w, fault.StatusCode, fault.ErrorCode)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, statusCode int, errorCode appstoreserver.APIErrorCode) {
+	writeJSON(w, statusCode, appstoreserver.APIError{ErrorCode: int(errorCode), ErrorMessage: errorCode.String()})
+}
+
+func generatePrivateKeyPEM() ([]byte, error) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate API key: %w", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode API key: %w", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
@@ -0,0 +1,314 @@
+package appstoreservertest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	appstoreserver "github.com/gh73962/appleapis/appstoreserver/v1"
+	"github.com/gh73962/appleapis/appstoreservernotifications/v2"
+)
+
+func newTestServer(t *testing.T, options ...Option) *Server {
+	t.Helper()
+
+	server, err := NewServer(options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newTestClient(t *testing.T, server *Server, options ...appstoreserver.Option) *appstoreserver.Client {
+	t.Helper()
+
+	client, err := appstoreserver.New(append(server.ClientOptions(), options...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func signTestTransaction(t *testing.T, server *Server, claims jwt.MapClaims) string {
+	t.Helper()
+
+	signed, err := server.sign(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func seedTestCustomer(t *testing.T, server *Server) []string {
+	t.Helper()
+
+	now := time.Now()
+	var signed []string
+	for i, id := range []string{"1000", "1001", "1002"} {
+		claims := jwt.MapClaims{
+			"transactionId":               id,
+			"originalTransactionId":       "1000",
+			"productId":                   "monthly",
+			"subscriptionGroupIdentifier": "group",
+			"bundleId":                    DefaultBundleID,
+			"environment":                 appstoreserver.EnvironmentLocalTesting,
+			"type":                        appstoreserver.TypeAutoRenewableSubscription,
+			"purchaseDate":                now.Add(time.Duration(i-3) * 30 * 24 * time.Hour).UnixMilli(),
+			"expiresDate":                 now.Add(time.Duration(i-2) * 30 * 24 * time.Hour).UnixMilli(),
+			"signedDate":                  now.UnixMilli(),
+		}
+		if id == "1001" {
+			claims["revocationDate"] = now.UnixMilli()
+			claims["revocationReason"] = 0
+		}
+		signed = append(signed, signTestTransaction(t, server, claims))
+	}
+
+	if err := server.SeedTransactions(signed...); err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestServerTransactionHistory(t *testing.T) {
+	server := newTestServer(t, WithPageSize(2))
+	seedTestCustomer(t, server)
+	client := newTestClient(t, server)
+
+	req := &appstoreserver.TransactionHistoryRequest{TransactionID: "1002", Sort: "DESCENDING"}
+	var ids []string
+	for transaction, err := range client.AllTransactions(context.Background(), req) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, transaction.TransactionID)
+	}
+	if len(ids) != 3 || ids[0] != "1002" || ids[2] != "1000" {
+		t.Fatalf("expected [1002 1001 1000], got %v", ids)
+	}
+	if len(server.Requests()) != 2 {
+		t.Fatalf("expected %d requests, got %d", 2, len(server.Requests()))
+	}
+
+	info, err := client.GetTransactionInfo(context.Background(), "1001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.SignedTransactionInfo == "" {
+		t.Fatal("expected signed transaction info")
+	}
+
+	var refunds []string
+	for transaction, err := range client.AllRefunds(context.Background(), &appstoreserver.RefundHistoryRequest{TransactionID: "1000"}) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		refunds = append(refunds, transaction.TransactionID)
+	}
+	if len(refunds) != 1 || refunds[0] != "1001" {
+		t.Fatalf("expected [1001], got %v", refunds)
+	}
+
+	_, err = client.GetTransactionInfo(context.Background(), "9999")
+	if !errors.Is(err, appstoreserver.ErrTransactionIDNotFound) {
+		t.Fatalf("expected %v, got %v", appstoreserver.ErrTransactionIDNotFound, err)
+	}
+}
+
+func TestServerSubscriptions(t *testing.T) {
+	server := newTestServer(t)
+	signed := seedTestCustomer(t, server)
+	renewalInfo := signTestTransaction(t, server, jwt.MapClaims{"originalTransactionId": "1000", "autoRenewStatus": 1})
+	if err := server.SeedStatus(appstoreserver.StatusActive, signed[2], renewalInfo); err != nil {
+		t.Fatal(err)
+	}
+	client := newTestClient(t, server)
+	ctx := context.Background()
+
+	statuses, err := client.GetAllSubscriptionStatuses(ctx, "1002")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses.Data) != 1 || statuses.Data[0].SubscriptionGroupIdentifier != "group" || statuses.Data[0].LastTransactions[0].Status != appstoreserver.StatusActive {
+		t.Fatalf("expected active status in group, got %+v", statuses.Data)
+	}
+
+	statuses, err = client.GetAllSubscriptionStatuses(ctx, "1002", appstoreserver.StatusExpired)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses.Data) != 0 {
+		t.Fatalf("expected no expired subscriptions, got %+v", statuses.Data)
+	}
+
+	extended, err := client.ExtendSubscriptionRenewalDate(ctx, &appstoreserver.ExtendRenewalDateRequest{
+		OriginalTransactionID: "1000",
+		ExtendByDays:          7,
+		ExtendReasonCode:      1,
+		RequestIdentifier:     "request",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !extended.Success || len(server.Extensions()) != 1 {
+		t.Fatalf("expected recorded extension, got %+v", extended)
+	}
+
+	if _, err := client.MassExtendSubscriptionRenewalDate(ctx, &appstoreserver.MassExtendRenewalDateRequest{
+		RequestIdentifier: "mass",
+		ExtendByDays:      7,
+		ExtendReasonCode:  1,
+		ProductID:         "monthly",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	status, err := client.GetMassExtendRenewalDateStatus(ctx, "monthly", "mass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.Complete || status.SucceededCount != 1 {
+		t.Fatalf("expected completed mass extension, got %+v", status)
+	}
+
+	if err := client.SetAppAccountToken(ctx, &appstoreserver.UpdateAppAccountTokenRequest{
+		OriginalTransactionID: "1000",
+		AppAccountToken:       "7389a31a-fb6d-4569-a2a6-db7d85d84813",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if server.AppAccountToken("1000") != "7389a31a-fb6d-4569-a2a6-db7d85d84813" {
+		t.Fatalf("expected app account token, got %q", server.AppAccountToken("1000"))
+	}
+
+	if err := client.SendConsumptionInfo(ctx, &appstoreserver.ConsumptionRequest{
+		TransactionID:     "1001",
+		AppAccountToken:   "7389a31a-fb6d-4569-a2a6-db7d85d84813",
+		CustomerConsented: true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := server.ConsumptionRequest("1001"); !ok {
+		t.Fatal("expected consumption request")
+	}
+
+	server.SeedOrder("order", signed[0])
+	order, err := client.LookUpOrderID(ctx, "order")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order.Status != appstoreserver.OrderLookupStatusValid || len(order.SignedTransactions) != 1 {
+		t.Fatalf("expected valid order, got %+v", order)
+	}
+}
+
+func TestServerNotifications(t *testing.T) {
+	server := newTestServer(t, WithPageSize(1))
+	client := newTestClient(t, server)
+	ctx := context.Background()
+
+	now := time.Now()
+	var items []appstoreserver.NotificationHistoryResponseItem
+	for i, result := range []appstoreserver.SendAttemptResult{appstoreserver.SendAttemptResultSuccess, appstoreserver.SendAttemptResultTimedOut, appstoreserver.SendAttemptResultOther} {
+		signedPayload := signTestTransaction(t, server, jwt.MapClaims{
+			"notificationType": appstoreservernotifications.TypeDidRenew,
+			"notificationUUID": string(rune('a' + i)),
+			"signedDate":       now.Add(time.Duration(i-3) * time.Hour).UnixMilli(),
+			"data": map[string]any{
+				"bundleId":    DefaultBundleID,
+				"environment": appstoreserver.EnvironmentLocalTesting,
+			},
+		})
+		items = append(items, appstoreserver.NotificationHistoryResponseItem{
+			SignedPayload: signedPayload,
+			SendAttempts:  []appstoreserver.SendAttemptItem{{AttemptDate: now.UnixMilli(), SendAttemptResult: result}},
+		})
+	}
+	if err := server.SeedNotifications(items...); err != nil {
+		t.Fatal(err)
+	}
+
+	req := &appstoreserver.NotificationHistoryRequest{StartTime: now.Add(-24 * time.Hour), EndTime: now, OnlyFailures: true}
+	var uuids []string
+	for item, err := range client.AllNotifications(ctx, req) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		uuids = append(uuids, item.Payload.NotificationUUID)
+	}
+	if len(uuids) != 2 || uuids[0] != "b" || uuids[1] != "c" {
+		t.Fatalf("expected [b c], got %v", uuids)
+	}
+
+	_, err := client.GetNotificationHistory(ctx, &appstoreserver.NotificationHistoryRequest{StartTime: now.Add(-200 * 24 * time.Hour), EndTime: now})
+	if !errors.Is(err, appstoreserver.ErrStartDateTooFarInPast) {
+		t.Fatalf("expected %v, got %v", appstoreserver.ErrStartDateTooFarInPast, err)
+	}
+
+	sent, err := client.RequestTestNotification(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, err := client.GetTestNotificationStatus(ctx, sent.TestNotificationToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var payload appstoreservernotifications.DecodedPayload
+	if err := decodePayload(status.SignedPayload, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.NotificationType != appstoreservernotifications.TypeTest {
+		t.Fatalf("expected %v, got %v", appstoreservernotifications.TypeTest, payload.NotificationType)
+	}
+}
+
+func TestServerAuthentication(t *testing.T) {
+	server := newTestServer(t)
+	seedTestCustomer(t, server)
+
+	other := newTestServer(t)
+	client := newTestClient(t, server, appstoreserver.WithPrivateKey(other.PrivateKeyPEM()))
+
+	_, err := client.GetTransactionInfo(context.Background(), "1000")
+	var apiErr *appstoreserver.APIError
+	if !errors.As(err, &apiErr) || apiErr.HTTPStatus != http.StatusUnauthorized {
+		t.Fatalf("expected HTTP 401, got %v", err)
+	}
+
+	client = newTestClient(t, server, appstoreserver.WithBundleID("com.example.other"))
+	if _, err := client.GetTransactionInfo(context.Background(), "1000"); !errors.As(err, &apiErr) || apiErr.HTTPStatus != http.StatusUnauthorized {
+		t.Fatalf("expected HTTP 401, got %v", err)
+	}
+}
+
+func TestServerFaults(t *testing.T) {
+	server := newTestServer(t)
+	seedTestCustomer(t, server)
+
+	client := newTestClient(t, server)
+	server.InjectRateLimit(1, 3*time.Second)
+	_, err := client.GetTransactionInfo(context.Background(), "1000")
+	var apiErr *appstoreserver.APIError
+	if !errors.As(err, &apiErr) || !apiErr.IsRateLimited() || apiErr.RetryAfter != 3*time.Second {
+		t.Fatalf("expected rate limit with Retry-After, got %v", err)
+	}
+
+	client = newTestClient(t, server, appstoreserver.WithRetryPolicy(&appstoreserver.RetryPolicy{
+		MaxRetries:     3,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     time.Millisecond,
+	}))
+	server.InjectServerError(2, http.StatusServiceUnavailable)
+	server.InjectRateLimit(1, 0)
+	before := len(server.Requests())
+	if _, err := client.GetTransactionInfo(context.Background(), "1000"); err != nil {
+		t.Fatal(err)
+	}
+	if requests := len(server.Requests()) - before; requests != 4 {
+		t.Fatalf("expected %d requests, got %d", 4, requests)
+	}
+}
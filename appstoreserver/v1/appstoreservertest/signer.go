@@ -0,0 +1,262 @@
+package appstoreservertest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/ocsp"
+
+	appstoreserver "github.com/gh73962/appleapis/appstoreserver/v1"
+	"github.com/gh73962/appleapis/appstoreservernotifications/v2"
+)
+
+var (
+	// oidAppleLeaf marks the leaf certificate that signs App Store data
+	oidAppleLeaf = asn1.ObjectIdentifier{1, 2, 840, 113635, 100, 6, 11, 1}
+	// oidAppleIntermediate marks the Apple Worldwide Developer Relations intermediate certificate
+	oidAppleIntermediate = asn1.ObjectIdentifier{1, 2, 840, 113635, 100, 6, 2, 1}
+	// asn1Null is the value of the Apple marker extensions
+	asn1Null = []byte{0x05, 0x00}
+)
+
+// SignerOption is a function type for configuring Signer
+type SignerOption func(*signerConfig)
+
+type signerConfig struct {
+	notBefore  time.Time
+	notAfter   time.Time
+	ocspServer string
+}
+
+// WithValidity sets the validity period of every certificate in the chain,
+// by default the certificates are valid from 20 years ago until 20 years from now
+func WithValidity(notBefore, notAfter time.Time) SignerOption {
+	return func(c *signerConfig) {
+		c.notBefore = notBefore
+		c.notAfter = notAfter
+	}
+}
+
+// WithOCSPServer sets the OCSP responder URL of the leaf and intermediate certificates
+func WithOCSPServer(val string) SignerOption {
+	return func(c *signerConfig) {
+		c.ocspServer = val
+	}
+}
+
+// Signer signs App Store data with a generated root, intermediate and leaf certificate chain
+// carrying Apple's OIDs, so SignedDataVerifier verifies it in the Sandbox and Production
+// environments when the root certificate is trusted
+type Signer struct {
+	key             *ecdsa.PrivateKey
+	root            *x509.Certificate
+	intermediate    *x509.Certificate
+	leaf            *x509.Certificate
+	rootKey         *ecdsa.PrivateKey
+	intermediateKey *ecdsa.PrivateKey
+}
+
+// NewSigner generates a new certificate chain and signing key
+func NewSigner(options ...SignerOption) (*Signer, error) {
+	now := time.Now()
+	config := signerConfig{
+		notBefore: now.AddDate(-20, 0, 0),
+		notAfter:  now.AddDate(20, 0, 0),
+	}
+	for _, option := range options {
+		option(&config)
+	}
+
+	var (
+		s   Signer
+		err error
+	)
+	if s.rootKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+		return nil, fmt.Errorf("failed to generate root key: %w", err)
+	}
+	if s.intermediateKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+		return nil, fmt.Errorf("failed to generate intermediate key: %w", err)
+	}
+	if s.key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+		return nil, fmt.Errorf("failed to generate signing key: %w", err)
+	}
+
+	var ocspServer []string
+	if config.ocspServer != "" {
+		ocspServer = []string{config.ocspServer}
+	}
+
+	root := x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Apple Root CA - G3", Organization: []string{"Apple Inc."}},
+		NotBefore:             config.notBefore,
+		NotAfter:              config.notAfter,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	if s.root, err = createCertificate(&root, &root, &s.rootKey.PublicKey, s.rootKey); err != nil {
+		return nil, err
+	}
+
+	intermediate := x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               pkix.Name{CommonName: "Test Apple Worldwide Developer Relations Certification Authority", Organization: []string{"Apple Inc."}},
+		NotBefore:             config.notBefore,
+		NotAfter:              config.notAfter,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+		OCSPServer:            ocspServer,
+		ExtraExtensions:       []pkix.Extension{{Id: oidAppleIntermediate, Value: asn1Null}},
+	}
+	if s.intermediate, err = createCertificate(&intermediate, s.root, &s.intermediateKey.PublicKey, s.rootKey); err != nil {
+		return nil, err
+	}
+
+	leaf := x509.Certificate{
+		SerialNumber:    big.NewInt(3),
+		Subject:         pkix.Name{CommonName: "Test Prod ECC Mac App Store and iTunes Store Receipt Signing", Organization: []string{"Apple Inc."}},
+		NotBefore:       config.notBefore,
+		NotAfter:        config.notAfter,
+		KeyUsage:        x509.KeyUsageDigitalSignature,
+		OCSPServer:      ocspServer,
+		ExtraExtensions: []pkix.Extension{{Id: oidAppleLeaf, Value: asn1Null}},
+	}
+	if s.leaf, err = createCertificate(&leaf, s.intermediate, &s.key.PublicKey, s.intermediateKey); err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+// RootCertificate returns the DER encoded root certificate, to be trusted with WithRootCertificates
+func (s *Signer) RootCertificate() []byte {
+	return s.root.Raw
+}
+
+// IntermediateCertificate returns the intermediate certificate
+func (s *Signer) IntermediateCertificate() *x509.Certificate {
+	return s.intermediate
+}
+
+// LeafCertificate returns the leaf certificate
+func (s *Signer) LeafCertificate() *x509.Certificate {
+	return s.leaf
+}
+
+// Chain returns the x5c header value: the base64 DER leaf, intermediate and root certificates
+func (s *Signer) Chain() []string {
+	return []string{
+		base64.StdEncoding.EncodeToString(s.leaf.Raw),
+		base64.StdEncoding.EncodeToString(s.intermediate.Raw),
+		base64.StdEncoding.EncodeToString(s.root.Raw),
+	}
+}
+
+// SigningKey returns the private key of the leaf certificate, to sign data with a modified x5c header
+func (s *Signer) SigningKey() *ecdsa.PrivateKey {
+	return s.key
+}
+
+// Sign signs claims as an ES256 JWS with the certificate chain in the x5c header.
+// claims is encoded to JSON, so any of the decoded payload types can be signed.
+func (s *Signer) Sign(claims any) (string, error) {
+	mapClaims, ok := claims.(jwt.MapClaims)
+	if !ok {
+		raw, err := json.Marshal(claims)
+		if err != nil {
+			return "", fmt.Errorf("failed to encode claims: %w", err)
+		}
+		if err := json.Unmarshal(raw, &mapClaims); err != nil {
+			return "", fmt.Errorf("claims must encode to a JSON object: %w", err)
+		}
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, mapClaims)
+	token.Header["x5c"] = s.Chain()
+	return token.SignedString(s.key)
+}
+
+// SignTransaction signs a transaction as returned in signedTransactionInfo
+func (s *Signer) SignTransaction(transaction *appstoreserver.JWSTransactionDecodedPayload) (string, error) {
+	return s.Sign(transaction)
+}
+
+// SignRenewalInfo signs subscription renewal information as returned in signedRenewalInfo
+func (s *Signer) SignRenewalInfo(renewalInfo *appstoreserver.JWSRenewalInfoDecodedPayload) (string, error) {
+	return s.Sign(renewalInfo)
+}
+
+// SignAppTransaction signs an app transaction as returned by StoreKit
+func (s *Signer) SignAppTransaction(appTransaction *appstoreserver.JWSAppTransactionDecodedPayload) (string, error) {
+	return s.Sign(appTransaction)
+}
+
+// SignNotification signs a notification as sent in signedPayload
+func (s *Signer) SignNotification(notification *appstoreservernotifications.DecodedPayload) (string, error) {
+	return s.Sign(notification)
+}
+
+// CreateOCSPResponse creates an OCSP response from template for the certificate of the DER encoded
+// request, signed by the issuer of that certificate. The serial number is taken from the request
+// and ThisUpdate defaults to the current time.
+func (s *Signer) CreateOCSPResponse(request []byte, template ocsp.Response) ([]byte, error) {
+	req, err := ocsp.ParseRequest(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse OCSP request: %w", err)
+	}
+
+	var (
+		issuer *x509.Certificate
+		key    *ecdsa.PrivateKey
+	)
+	switch {
+	case req.SerialNumber.Cmp(s.leaf.SerialNumber) == 0:
+		issuer, key = s.intermediate, s.intermediateKey
+	case req.SerialNumber.Cmp(s.intermediate.SerialNumber) == 0:
+		issuer, key = s.root, s.rootKey
+	default:
+		return nil, fmt.Errorf("unknown certificate serial number %v", req.SerialNumber)
+	}
+
+	template.SerialNumber = req.SerialNumber
+	if template.ThisUpdate.IsZero() {
+		template.ThisUpdate = time.Now()
+	}
+	return ocsp.CreateResponse(issuer, issuer, template, key)
+}
+
+// CreateRevocationList creates a DER encoded CRL from template, signed by issuer which is
+// the intermediate certificate or the parsed root certificate of the chain
+func (s *Signer) CreateRevocationList(template *x509.RevocationList, issuer *x509.Certificate) ([]byte, error) {
+	var key *ecdsa.PrivateKey
+	switch {
+	case issuer.Equal(s.intermediate):
+		key = s.intermediateKey
+	case issuer.Equal(s.root):
+		key = s.rootKey
+	default:
+		return nil, fmt.Errorf("certificate %q is not an issuer of the chain", issuer.Subject.CommonName)
+	}
+	return x509.CreateRevocationList(rand.Reader, template, issuer, key)
+}
+
+func createCertificate(template, parent *x509.Certificate, publicKey *ecdsa.PublicKey, signer *ecdsa.PrivateKey) (*x509.Certificate, error) {
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, publicKey, signer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate %q: %w", template.Subject.CommonName, err)
+	}
+	return x509.ParseCertificate(der)
+}
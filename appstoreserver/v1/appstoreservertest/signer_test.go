@@ -0,0 +1,245 @@
+package appstoreservertest
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	appstoreserver "github.com/gh73962/appleapis/appstoreserver/v1"
+	"github.com/gh73962/appleapis/appstoreservernotifications/v2"
+	"golang.org/x/crypto/ocsp"
+)
+
+func newTestVerifier(t *testing.T, signer *Signer, environment appstoreserver.Environment) *appstoreserver.SignedDataVerifier {
+	t.Helper()
+
+	verifier, err := appstoreserver.NewSignedDataVerifier(&appstoreserver.ClientConfig{
+		BundleID:         DefaultBundleID,
+		Environment:      environment,
+		AppAppleID:       1234,
+		RootCertificates: [][]byte{signer.RootCertificate()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return verifier
+}
+
+func expectVerificationStatus(t *testing.T, err error, status appstoreserver.VerificationStatus) {
+	t.Helper()
+
+	var verificationErr *appstoreserver.VerificationError
+	if !errors.As(err, &verificationErr) || verificationErr.Status != status {
+		t.Fatalf("expected verification status %v, got %v", status, err)
+	}
+}
+
+func TestSignerVerifiesInEnvironment(t *testing.T) {
+	signer, err := NewSigner()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signedDate := time.Now().UnixMilli()
+
+	for _, environment := range []appstoreserver.Environment{appstoreserver.EnvironmentSandbox, appstoreserver.EnvironmentProduction} {
+		t.Run(environment.String(), func(t *testing.T) {
+			verifier := newTestVerifier(t, signer, environment)
+
+			signedTransaction, err := signer.SignTransaction(&appstoreserver.JWSTransactionDecodedPayload{
+				TransactionID: "1000",
+				BundleID:      DefaultBundleID,
+				Environment:   environment,
+				SignedDate:    signedDate,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			transaction, err := verifier.VerifyAndDecodeSignedTransaction(signedTransaction)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if transaction.TransactionID != "1000" {
+				t.Fatalf("expected %v, got %v", "1000", transaction.TransactionID)
+			}
+
+			signedRenewalInfo, err := signer.SignRenewalInfo(&appstoreserver.JWSRenewalInfoDecodedPayload{
+				OriginalTransactionID: "1000",
+				Environment:           environment,
+				SignedDate:            signedDate,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := verifier.VerifyAndDecodeRenewalInfo(signedRenewalInfo); err != nil {
+				t.Fatal(err)
+			}
+
+			signedAppTransaction, err := signer.SignAppTransaction(&appstoreserver.JWSAppTransactionDecodedPayload{
+				ReceiptType:         environment,
+				AppAppleID:          1234,
+				BundleID:            DefaultBundleID,
+				ReceiptCreationDate: signedDate,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := verifier.VerifyAndDecodeAppTransaction(signedAppTransaction); err != nil {
+				t.Fatal(err)
+			}
+
+			signedPayload, err := signer.SignNotification(&appstoreservernotifications.DecodedPayload{
+				NotificationType: appstoreservernotifications.TypeDidRenew,
+				NotificationUUID: "002e14d5-51f5-4503-b5a8-c3a1af68eb20",
+				SignedDate:       signedDate,
+				Data: &appstoreservernotifications.Data{
+					AppAppleID:            1234,
+					BundleID:              DefaultBundleID,
+					Environment:           environment.String(),
+					SignedTransactionInfo: signedTransaction,
+					SignedRenewalInfo:     signedRenewalInfo,
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			notification, err := verifier.VerifyAndDecodeNotificationWithInfo(signedPayload)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if notification.Transaction == nil || notification.RenewalInfo == nil {
+				t.Fatalf("expected decoded transaction and renewal info, got %+v", notification)
+			}
+		})
+	}
+}
+
+func TestSignerRejected(t *testing.T) {
+	signer, err := NewSigner()
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier := newTestVerifier(t, signer, appstoreserver.EnvironmentSandbox)
+	transaction := &appstoreserver.JWSTransactionDecodedPayload{
+		TransactionID: "1000",
+		BundleID:      DefaultBundleID,
+		Environment:   appstoreserver.EnvironmentSandbox,
+		SignedDate:    time.Now().UnixMilli(),
+	}
+
+	signed, err := signer.SignTransaction(transaction)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(signed, ".")
+	other, err := signer.SignTransaction(&appstoreserver.JWSTransactionDecodedPayload{
+		TransactionID: "2000",
+		BundleID:      DefaultBundleID,
+		Environment:   appstoreserver.EnvironmentSandbox,
+		SignedDate:    transaction.SignedDate,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := parts[0] + "." + strings.Split(other, ".")[1] + "." + parts[2]
+	_, err = verifier.VerifyAndDecodeSignedTransaction(tampered)
+	expectVerificationStatus(t, err, appstoreserver.VerificationStatusFailure)
+
+	transaction.Environment = appstoreserver.EnvironmentProduction
+	signed, err = signer.SignTransaction(transaction)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = verifier.VerifyAndDecodeSignedTransaction(signed)
+	expectVerificationStatus(t, err, appstoreserver.VerificationStatusInvalidEnvironment)
+
+	expired, err := NewSigner(WithValidity(time.Now().AddDate(-2, 0, 0), time.Now().AddDate(-1, 0, 0)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	transaction.Environment = appstoreserver.EnvironmentSandbox
+	signed, err = expired.SignTransaction(transaction)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = newTestVerifier(t, expired, appstoreserver.EnvironmentSandbox).VerifyAndDecodeSignedTransaction(signed)
+	expectVerificationStatus(t, err, appstoreserver.VerificationStatusFailure)
+}
+
+func TestSignerRevocation(t *testing.T) {
+	signer, err := NewSigner()
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := x509.ParseCertificate(signer.RootCertificate())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, pair := range [][2]*x509.Certificate{
+		{signer.LeafCertificate(), signer.IntermediateCertificate()},
+		{signer.IntermediateCertificate(), root},
+	} {
+		request, err := ocsp.CreateRequest(pair[0], pair[1], nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw, err := signer.CreateOCSPResponse(request, ocsp.Response{Status: ocsp.Revoked, RevokedAt: time.Now()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		response, err := ocsp.ParseResponseForCert(raw, pair[0], pair[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if response.Status != ocsp.Revoked {
+			t.Fatalf("expected status %d, got %d", ocsp.Revoked, response.Status)
+		}
+	}
+
+	for _, issuer := range []*x509.Certificate{signer.IntermediateCertificate(), root} {
+		raw, err := signer.CreateRevocationList(&x509.RevocationList{Number: big.NewInt(1), ThisUpdate: time.Now(), NextUpdate: time.Now().Add(time.Hour)}, issuer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		crl, err := x509.ParseRevocationList(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := crl.CheckSignatureFrom(issuer); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := signer.CreateRevocationList(&x509.RevocationList{Number: big.NewInt(1)}, signer.LeafCertificate()); err == nil {
+		t.Fatal("expected error but got nil")
+	}
+}
+
+func TestServerSignsVerifiableData(t *testing.T) {
+	server := newTestServer(t, WithEnvironment(appstoreserver.EnvironmentSandbox), WithAppAppleID(1234))
+	signed, err := server.Signer().SignTransaction(&appstoreserver.JWSTransactionDecodedPayload{
+		TransactionID:         "1000",
+		OriginalTransactionID: "1000",
+		BundleID:              DefaultBundleID,
+		Environment:           appstoreserver.EnvironmentSandbox,
+		SignedDate:            time.Now().UnixMilli(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := server.SeedTransactions(signed); err != nil {
+		t.Fatal(err)
+	}
+
+	client := newTestClient(t, server, appstoreserver.WithEnableAutoDecode())
+	info, err := client.GetTransactionInfo(context.Background(), "1000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Payload == nil || info.Payload.TransactionID != "1000" {
+		t.Fatalf("expected decoded transaction, got %+v", info.Payload)
+	}
+}
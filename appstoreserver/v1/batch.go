@@ -0,0 +1,119 @@
+package appstoreserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+// ErrBatchAborted is the error of batch items skipped after another item failed in fail-fast mode
+var ErrBatchAborted = errors.New("batch verification aborted")
+
+// SignedDataType is the type of signed data in a BatchItem
+type SignedDataType int
+
+const (
+	// SignedDataTypeTransaction is a signedTransaction / signedTransactionInfo
+	SignedDataTypeTransaction SignedDataType = iota
+	// SignedDataTypeRenewalInfo is a signedRenewalInfo
+	SignedDataTypeRenewalInfo
+)
+
+// BatchItem is signed data to verify with VerifyBatch
+type BatchItem struct {
+	Type       SignedDataType
+	SignedData string
+}
+
+// BatchResult is the outcome of verifying the BatchItem at the same index.
+// Transaction or RenewalInfo is set depending on the type of the item, unless Err is set.
+type BatchResult struct {
+	Transaction *JWSTransactionDecodedPayload
+	RenewalInfo *JWSRenewalInfoDecodedPayload
+	Err         error
+}
+
+// BatchOption configures VerifyBatch
+type BatchOption func(*batchConfig)
+
+type batchConfig struct {
+	concurrency int
+	failFast    bool
+}
+
+// WithBatchConcurrency sets the number of items verified concurrently, defaults to GOMAXPROCS
+func WithBatchConcurrency(n int) BatchOption {
+	return func(c *batchConfig) {
+		c.concurrency = n
+	}
+}
+
+// WithBatchFailFast stops verifying at the first invalid item, the items not verified yet fail with ErrBatchAborted
+func WithBatchFailFast() BatchOption {
+	return func(c *batchConfig) {
+		c.failFast = true
+	}
+}
+
+// VerifyBatch verifies and decodes items with a bounded pool of workers.
+// The results are in the order of items, the returned error joins the errors of all failed items
+// except ErrBatchAborted. Items not verified when ctx is done fail with its error.
+func (v *SignedDataVerifier) VerifyBatch(ctx context.Context, items []BatchItem, options ...BatchOption) ([]BatchResult, error) {
+	config := batchConfig{concurrency: runtime.GOMAXPROCS(0)}
+	for _, option := range options {
+		option(&config)
+	}
+	config.concurrency = max(1, min(config.concurrency, len(items)))
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	results := make([]BatchResult, len(items))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for range config.concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				if ctx.Err() != nil {
+					results[i].Err = context.Cause(ctx)
+					continue
+				}
+				results[i] = v.verifyBatchItem(items[i])
+				if results[i].Err != nil && config.failFast {
+					cancel(ErrBatchAborted)
+				}
+			}
+		}()
+	}
+	for i := range items {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	var errs []error
+	for i, result := range results {
+		if result.Err != nil && !errors.Is(result.Err, ErrBatchAborted) {
+			errs = append(errs, fmt.Errorf("item %d: %w", i, result.Err))
+		}
+	}
+	return results, errors.Join(errs...)
+}
+
+// verifyBatchItem verifies and decodes item according to its type
+func (v *SignedDataVerifier) verifyBatchItem(item BatchItem) BatchResult {
+	var result BatchResult
+	switch item.Type {
+	case SignedDataTypeTransaction:
+		result.Transaction, result.Err = v.VerifyAndDecodeSignedTransaction(item.SignedData)
+	case SignedDataTypeRenewalInfo:
+		result.RenewalInfo, result.Err = v.VerifyAndDecodeRenewalInfo(item.SignedData)
+	default:
+		result.Err = fmt.Errorf("unknown signed data type %d", item.Type)
+	}
+	return result
+}
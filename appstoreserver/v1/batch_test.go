@@ -0,0 +1,257 @@
+package appstoreserver_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	appstoreserver "github.com/gh73962/appleapis/appstoreserver/v1"
+	"github.com/gh73962/appleapis/appstoreserver/v1/appstoreservertest"
+)
+
+// newTestClient returns a Sandbox client of com.example trusting signer and sending its requests to handler
+func newTestClient(t *testing.T, signer *appstoreservertest.Signer, handler roundTripFunc, options ...appstoreserver.Option) *appstoreserver.Client {
+	t.Helper()
+
+	pk, err := os.ReadFile("../../testdata/certs/testSigningKey.p8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := appstoreserver.New(append([]appstoreserver.Option{
+		appstoreserver.WithBundleID(appstoreservertest.DefaultBundleID),
+		appstoreserver.WithEnvironment(appstoreserver.EnvironmentSandbox),
+		appstoreserver.WithKeyID("keyId"),
+		appstoreserver.WithIssuerID("issuerId"),
+		appstoreserver.WithPrivateKey(pk),
+		appstoreserver.WithRootCertificates([][]byte{signer.RootCertificate()}),
+		appstoreserver.WithHTTPClient(&http.Client{Transport: handler}),
+	}, options...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+// jsonResponse returns a response with body encoded to JSON
+func jsonResponse(body any) (*http.Response, error) {
+	raw, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(bytes.NewReader(raw)),
+	}, nil
+}
+
+// signTestTransactions signs n transactions whose transactionId is their index
+func signTestTransactions(t *testing.T, signer *appstoreservertest.Signer, n int) []string {
+	t.Helper()
+
+	signedTransactions := make([]string, n)
+	for i := range signedTransactions {
+		signedTransactions[i] = signTestTransaction(t, signer, strconv.Itoa(i), time.Now())
+	}
+	return signedTransactions
+}
+
+func transactionItems(signedTransactions []string) []appstoreserver.BatchItem {
+	items := make([]appstoreserver.BatchItem, len(signedTransactions))
+	for i, v := range signedTransactions {
+		items[i] = appstoreserver.BatchItem{Type: appstoreserver.SignedDataTypeTransaction, SignedData: v}
+	}
+	return items
+}
+
+func TestVerifyBatch(t *testing.T) {
+	signer := newTestSigner(t)
+	signedTransactions := signTestTransactions(t, signer, 20)
+	verifier := newTestVerifier(t, signer, appstoreserver.ClientConfig{})
+
+	items := transactionItems(signedTransactions)
+	items[7].SignedData = signTestTransaction(t, newTestSigner(t), "7", time.Now())
+	renewalInfo, err := signer.SignRenewalInfo(&appstoreserver.JWSRenewalInfoDecodedPayload{
+		Environment:        appstoreserver.EnvironmentSandbox,
+		AutoRenewProductID: "com.example.product",
+		SignedDate:         time.Now().UnixMilli(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	items = append(items, appstoreserver.BatchItem{Type: appstoreserver.SignedDataTypeRenewalInfo, SignedData: renewalInfo})
+
+	results, err := verifier.VerifyBatch(context.Background(), items, appstoreserver.WithBatchConcurrency(4))
+	expectVerificationFailure(t, err)
+	if len(results) != len(items) {
+		t.Fatalf("expected %d results, got %d", len(items), len(results))
+	}
+	for i, result := range results[:len(signedTransactions)] {
+		if i == 7 {
+			if result.Err == nil || result.Transaction != nil {
+				t.Fatalf("expected item %d to fail, got %+v", i, result)
+			}
+			continue
+		}
+		if result.Err != nil {
+			t.Fatal(result.Err)
+		}
+		if result.Transaction.TransactionID != strconv.Itoa(i) {
+			t.Fatalf("expected %q, got %q", strconv.Itoa(i), result.Transaction.TransactionID)
+		}
+	}
+	if result := results[len(results)-1]; result.Err != nil || result.RenewalInfo.AutoRenewProductID != "com.example.product" {
+		t.Fatalf("expected renewal info, got %+v", result)
+	}
+}
+
+func TestVerifyBatchFailFast(t *testing.T) {
+	signer := newTestSigner(t)
+	verifier := newTestVerifier(t, signer, appstoreserver.ClientConfig{})
+	items := transactionItems(signTestTransactions(t, signer, 5))
+	items[1].SignedData = "not.a.jwt"
+
+	results, err := verifier.VerifyBatch(context.Background(), items, appstoreserver.WithBatchConcurrency(1), appstoreserver.WithBatchFailFast())
+	if err == nil {
+		t.Fatal("expected error but got nil")
+	}
+	if results[0].Err != nil || results[1].Err == nil {
+		t.Fatalf("expected only item %d to fail, got %v and %v", 1, results[0].Err, results[1].Err)
+	}
+	for _, result := range results[2:] {
+		if !errors.Is(result.Err, appstoreserver.ErrBatchAborted) {
+			t.Fatalf("expected %v, got %v", appstoreserver.ErrBatchAborted, result.Err)
+		}
+	}
+	if errors.Is(err, appstoreserver.ErrBatchAborted) {
+		t.Fatalf("expected aborted items to be left out of %v", err)
+	}
+}
+
+func TestVerifyBatchCanceled(t *testing.T) {
+	signer := newTestSigner(t)
+	verifier := newTestVerifier(t, signer, appstoreserver.ClientConfig{})
+	items := transactionItems(signTestTransactions(t, signer, 3))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results, err := verifier.VerifyBatch(ctx, items)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected %v, got %v", context.Canceled, err)
+	}
+	for _, result := range results {
+		if !errors.Is(result.Err, context.Canceled) {
+			t.Fatalf("expected %v, got %v", context.Canceled, result.Err)
+		}
+	}
+}
+
+func TestAutoDecodeUsesVerifyBatch(t *testing.T) {
+	signer := newTestSigner(t)
+	signedTransactions := signTestTransactions(t, signer, 10)
+	response := appstoreserver.HistoryResponse{SignedTransactions: signedTransactions}
+	client := newTestClient(t, signer, func(req *http.Request) (*http.Response, error) {
+		return jsonResponse(response)
+	}, appstoreserver.WithEnableAutoDecode())
+
+	history, err := client.GetTransactionHistory(context.Background(), &appstoreserver.TransactionHistoryRequest{TransactionID: "1234"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history.Payloads) != len(signedTransactions) {
+		t.Fatalf("expected %d payloads, got %d", len(signedTransactions), len(history.Payloads))
+	}
+	for i, payload := range history.Payloads {
+		if payload.TransactionID != strconv.Itoa(i) {
+			t.Fatalf("expected %q, got %q", strconv.Itoa(i), payload.TransactionID)
+		}
+	}
+
+	response.SignedTransactions = append([]string(nil), signedTransactions...)
+	response.SignedTransactions[3] = signTestTransaction(t, newTestSigner(t), "3", time.Now())
+	if _, err := client.GetTransactionHistory(context.Background(), &appstoreserver.TransactionHistoryRequest{TransactionID: "1234"}); err == nil {
+		t.Fatal("expected error but got nil")
+	}
+
+	renewalInfo, err := signer.SignRenewalInfo(&appstoreserver.JWSRenewalInfoDecodedPayload{
+		Environment: appstoreserver.EnvironmentSandbox,
+		SignedDate:  time.Now().UnixMilli(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client = newTestClient(t, signer, func(req *http.Request) (*http.Response, error) {
+		return jsonResponse(appstoreserver.StatusResponse{Data: []appstoreserver.SubscriptionGroupIdentifierItem{{
+			LastTransactions: []appstoreserver.LastTransactionsItem{
+				{SignedRenewalInfo: renewalInfo, SignedTransactionInfo: signedTransactions[0]},
+				{SignedRenewalInfo: renewalInfo, SignedTransactionInfo: signedTransactions[1]},
+			},
+		}}})
+	}, appstoreserver.WithEnableAutoDecode())
+	statuses, err := client.GetAllSubscriptionStatuses(context.Background(), "1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, item := range statuses.Data[0].LastTransactions {
+		if item.RenewalPayload == nil || item.TransactionPayload.TransactionID != strconv.Itoa(i) {
+			t.Fatalf("expected payloads of item %d, got %+v", i, item)
+		}
+	}
+}
+
+func TestDecodePolicy(t *testing.T) {
+	signer := newTestSigner(t)
+
+	for _, tt := range []struct {
+		policy   appstoreserver.DecodePolicy
+		wantErr  bool
+		payloads []string
+	}{
+		{appstoreserver.DecodePolicyStrict, true, nil},
+		{appstoreserver.DecodePolicySkipInvalid, false, []string{"0", "2"}},
+		{appstoreserver.DecodePolicyKeepRaw, false, []string{"0", "", "2"}},
+	} {
+		signedTransactions := signTestTransactions(t, signer, 3)
+		signedTransactions[1] = "not.a.jwt"
+		client := newTestClient(t, signer, func(req *http.Request) (*http.Response, error) {
+			return jsonResponse(appstoreserver.HistoryResponse{Revision: "revision_1", HasMore: true, SignedTransactions: signedTransactions})
+		}, appstoreserver.WithEnableAutoDecode(), appstoreserver.WithDecodePolicy(tt.policy))
+
+		history, err := client.GetTransactionHistory(context.Background(), &appstoreserver.TransactionHistoryRequest{TransactionID: "1234"})
+		if tt.wantErr {
+			if err == nil {
+				t.Fatal("expected error but got nil")
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if history.Revision != "revision_1" || !history.HasMore {
+			t.Fatalf("expected the pagination state of the page, got %q %v", history.Revision, history.HasMore)
+		}
+		if len(history.Payloads) != len(tt.payloads) {
+			t.Fatalf("expected %d payloads, got %d", len(tt.payloads), len(history.Payloads))
+		}
+		for i, want := range tt.payloads {
+			if payload := history.Payloads[i]; (want == "" && payload != nil) || (want != "" && payload.TransactionID != want) {
+				t.Fatalf("expected payload %q at %d, got %+v", want, i, payload)
+			}
+		}
+		if len(history.DecodeErrors) != 1 || history.DecodeErrors[0].Index != 1 || history.DecodeErrors[0].SignedData != "not.a.jwt" {
+			t.Fatalf("expected a decode error for item %d, got %v", 1, history.DecodeErrors)
+		}
+		var verificationErr *appstoreserver.VerificationError
+		if !errors.As(history.DecodeErrors[0], &verificationErr) {
+			t.Fatalf("expected verification error, got %v", history.DecodeErrors[0])
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package appstoreserver_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	appstoreserver "github.com/gh73962/appleapis/appstoreserver/v1"
+	"github.com/gh73962/appleapis/appstoreserver/v1/appstoreservertest"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/ocsp"
+)
+
+// roundTripFunc sends the requests of an http.Client to a function
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func newTestSigner(t *testing.T, options ...appstoreservertest.SignerOption) *appstoreservertest.Signer {
+	t.Helper()
+
+	signer, err := appstoreservertest.NewSigner(options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+// newTestVerifier returns a Sandbox verifier of com.example trusting the root certificate of signer
+func newTestVerifier(t *testing.T, signer *appstoreservertest.Signer, config appstoreserver.ClientConfig) *appstoreserver.SignedDataVerifier {
+	t.Helper()
+
+	config.BundleID = appstoreservertest.DefaultBundleID
+	config.Environment = appstoreserver.EnvironmentSandbox
+	config.RootCertificates = [][]byte{signer.RootCertificate()}
+	verifier, err := appstoreserver.NewSignedDataVerifier(&config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return verifier
+}
+
+// signTestTransaction signs a Sandbox transaction of com.example whose signedDate is the effective date of its chain
+func signTestTransaction(t *testing.T, signer *appstoreservertest.Signer, transactionID string, signedDate time.Time) string {
+	t.Helper()
+
+	signed, err := signer.SignTransaction(&appstoreserver.JWSTransactionDecodedPayload{
+		TransactionID: transactionID,
+		BundleID:      appstoreservertest.DefaultBundleID,
+		Environment:   appstoreserver.EnvironmentSandbox,
+		SignedDate:    signedDate.UnixMilli(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+// ocspResponse answers the OCSP request in body with a response of status signed by signer
+func ocspResponse(signer *appstoreservertest.Signer, body io.Reader, status int) (*http.Response, error) {
+	request, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	response, err := signer.CreateOCSPResponse(request, ocsp.Response{
+		Status:     status,
+		ThisUpdate: now.Add(-time.Minute),
+		NextUpdate: now.Add(time.Hour),
+		RevokedAt:  now.Add(-time.Minute),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewReader(response))}, nil
+}
+
+func expectVerificationFailure(t *testing.T, err error) {
+	t.Helper()
+
+	var verificationErr *appstoreserver.VerificationError
+	if !errors.As(err, &verificationErr) || verificationErr.Status != appstoreserver.VerificationStatusFailure {
+		t.Fatalf("expected verification failure, got %v", err)
+	}
+}
+
+func TestOCSPUsesHTTPClient(t *testing.T) {
+	signer := newTestSigner(t, appstoreservertest.WithOCSPServer("http://ocsp.example.com/ocsp"))
+
+	for _, tt := range []struct {
+		name    string
+		status  int
+		wantErr bool
+	}{
+		{"good", ocsp.Good, false},
+		{"revoked", ocsp.Revoked, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests int
+			verifier := newTestVerifier(t, signer, appstoreserver.ClientConfig{
+				ChainCacheSize: -1,
+				RevocationChecker: &appstoreserver.OCSPRevocationChecker{HTTPClient: &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+					requests++
+					if req.URL.String() != "http://ocsp.example.com/ocsp" || req.Header.Get("Content-Type") != "application/ocsp-request" {
+						t.Fatalf("unexpected OCSP request %s %s", req.URL, req.Header.Get("Content-Type"))
+					}
+					if _, ok := req.Context().Deadline(); !ok {
+						t.Fatal("expected OCSP request with a deadline")
+					}
+					return ocspResponse(signer, req.Body, tt.status)
+				})}},
+			})
+
+			_, err := verifier.VerifyAndDecodeSignedTransaction(signTestTransaction(t, signer, "1", time.Now()))
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if requests == 0 {
+				t.Fatal("expected OCSP requests through the HTTP client")
+			}
+		})
+	}
+}
+
+func TestRevocationCheckerUsesVerifierHTTPClient(t *testing.T) {
+	signer := newTestSigner(t, appstoreservertest.WithOCSPServer("http://ocsp.example.com/ocsp"))
+
+	newHTTPClient := func(requests *int) *http.Client {
+		return &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			*requests++
+			return ocspResponse(signer, req.Body, ocsp.Good)
+		})}
+	}
+
+	// Verifiers sharing a checker without HTTP client each send its requests through their own client
+	checker := &appstoreserver.OCSPRevocationChecker{}
+	var firstRequests, secondRequests int
+	first := newTestVerifier(t, signer, appstoreserver.ClientConfig{ChainCacheSize: -1, RevocationChecker: checker, HTTPClient: newHTTPClient(&firstRequests)})
+	second := newTestVerifier(t, signer, appstoreserver.ClientConfig{ChainCacheSize: -1, RevocationChecker: checker, HTTPClient: newHTTPClient(&secondRequests)})
+
+	signedTransaction := signTestTransaction(t, signer, "1", time.Now())
+	if _, err := first.VerifyAndDecodeSignedTransaction(signedTransaction); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := second.VerifyAndDecodeSignedTransaction(signedTransaction); err != nil {
+		t.Fatal(err)
+	}
+	if firstRequests != 2 || secondRequests != 2 {
+		t.Fatalf("expected %d OCSP requests per verifier, got %d and %d", 2, firstRequests, secondRequests)
+	}
+	if checker.HTTPClient != nil {
+		t.Fatalf("expected the checker to be left unchanged, got %v", checker.HTTPClient)
+	}
+}
+
+func TestChainCache(t *testing.T) {
+	signer := newTestSigner(t)
+	signedTransaction := signTestTransaction(t, signer, "1", time.Now())
+
+	verifier := newTestVerifier(t, signer, appstoreserver.ClientConfig{})
+	for range 3 {
+		if _, err := verifier.VerifyAndDecodeSignedTransaction(signedTransaction); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if stats := verifier.ChainCacheStats(); stats.Hits != 2 || stats.Misses != 1 {
+		t.Fatalf("expected %d hits and %d misses, got %+v", 2, 1, stats)
+	}
+
+	// A cached chain isn't used outside its validity and a failed verification isn't cached
+	expired := signTestTransaction(t, signer, "2", signer.LeafCertificate().NotAfter.AddDate(0, 0, 1))
+	for range 2 {
+		_, err := verifier.VerifyAndDecodeSignedTransaction(expired)
+		expectVerificationFailure(t, err)
+	}
+	if stats := verifier.ChainCacheStats(); stats.Hits != 2 || stats.Misses != 3 || stats.Size != 1 {
+		t.Fatalf("expected %d hits, %d misses and %d cached chain, got %+v", 2, 3, 1, stats)
+	}
+
+	verifier = newTestVerifier(t, signer, appstoreserver.ClientConfig{ChainCacheSize: -1})
+	for range 2 {
+		if _, err := verifier.VerifyAndDecodeSignedTransaction(signedTransaction); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if stats := verifier.ChainCacheStats(); stats != (appstoreserver.ChainCacheStats{}) {
+		t.Fatalf("expected no cache usage, got %+v", stats)
+	}
+}
+
+func TestRootPinning(t *testing.T) {
+	// A self-made chain carrying the Apple OIDs and its own root in the x5c header
+	forged := newTestSigner(t)
+	signedTransaction := signTestTransaction(t, forged, "1", time.Now())
+
+	_, err := newTestVerifier(t, newTestSigner(t), appstoreserver.ClientConfig{}).VerifyAndDecodeSignedTransaction(signedTransaction)
+	expectVerificationFailure(t, err)
+
+	verifier := newTestVerifier(t, newTestSigner(t), appstoreserver.ClientConfig{InsecureSkipRootPinning: true})
+	if _, err := verifier.VerifyAndDecodeSignedTransaction(signedTransaction); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRootPinningForgedIntermediate(t *testing.T) {
+	signer := newTestSigner(t)
+	forged := newTestSigner(t)
+	verifier := newTestVerifier(t, signer, appstoreserver.ClientConfig{ChainCacheSize: -1})
+
+	sign := func(signer *appstoreservertest.Signer, x5c []string) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+			"transactionId": "1",
+			"bundleId":      appstoreservertest.DefaultBundleID,
+			"environment":   string(appstoreserver.EnvironmentSandbox),
+			"signedDate":    time.Now().UnixMilli(),
+		})
+		token.Header["x5c"] = x5c
+		signed, err := token.SignedString(signer.SigningKey())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+
+	if _, err := verifier.VerifyAndDecodeSignedTransaction(sign(signer, signer.Chain())); err != nil {
+		t.Fatal(err)
+	}
+
+	// The trusted root in the x5c header doesn't vouch for a forged intermediate
+	x5c := forged.Chain()
+	x5c[2] = signer.Chain()[2]
+	if _, err := verifier.VerifyAndDecodeSignedTransaction(sign(forged, x5c)); err == nil {
+		t.Fatal("expected error but got nil")
+	}
+
+	// Nor is a forged root trusted because it is in the x5c header
+	if _, err := verifier.VerifyAndDecodeSignedTransaction(sign(forged, forged.Chain())); err == nil {
+		t.Fatal("expected error but got nil")
+	}
+
+	// The root of a valid chain is taken from the trusted roots, not from the x5c header
+	x5c = signer.Chain()
+	x5c[2] = forged.Chain()[2]
+	if _, err := verifier.VerifyAndDecodeSignedTransaction(sign(signer, x5c)); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,6 +1,7 @@
 package appstoreserver
 
 import (
+	"context"
 	"net/http"
 	"time"
 )
@@ -12,10 +13,16 @@ type Client struct {
 	httpClient     *http.Client
 	userAgent      string
 	Verifier       *SignedDataVerifier
+	retryPolicy    *RetryPolicy
 }
 
 // New creates a new App Store Server instance using the option pattern
 func New(options ...Option) (*Client, error) {
+	return NewWithContext(context.Background(), options...)
+}
+
+// NewWithContext is like New, ctx bounds the download of the root certificates when none are configured
+func NewWithContext(ctx context.Context, options ...Option) (*Client, error) {
 	config := new(ClientConfig)
 	for _, option := range options {
 		option(config)
@@ -24,13 +31,14 @@ func New(options ...Option) (*Client, error) {
 	if err := config.Validate(); err != nil {
 		return nil, err
 	}
-	if err := config.Init(); err != nil {
+	if err := config.InitContext(ctx); err != nil {
 		return nil, err
 	}
 
 	c := Client{
-		baseURL:   config.Environment.BaseURL(),
-		userAgent: "app-store-server-library/go/1.0.0",
+		baseURL:     config.ResolveBaseURL(),
+		userAgent:   "app-store-server-library/go/1.0.0",
+		retryPolicy: config.RetryPolicy,
 	}
 
 	tokenGenerator, err := NewTokenGenerator(config)
@@ -55,3 +63,8 @@ func New(options ...Option) (*Client, error) {
 
 	return &c, nil
 }
+
+// BaseURL returns the base URL the client sends API requests to
+func (c *Client) BaseURL() string {
+	return c.baseURL
+}
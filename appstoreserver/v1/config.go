@@ -1,10 +1,17 @@
 package appstoreserver
 
 import (
+	"context"
+	"crypto/x509"
+	"embed"
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"net/http"
+	"net/url"
+	"path"
+	"strings"
 	"time"
 )
 
@@ -41,10 +48,32 @@ type ClientConfig struct {
 	// defaults to well-known Apple Root CAs if not provided.
 	RootCertificates [][]byte
 
-	// EnableOnlineChecks determines whether to perform online verification
-	// of certificates and CRL (Certificate Revocation List) checking.
+	// RootCertificatesFS provides the Apple Root CA certificates as .cer or .der files in its root directory,
+	// e.g. an embed.FS so no certificates are downloaded. It is used if RootCertificates is empty.
+	RootCertificatesFS fs.FS
+
+	// EnableOnlineChecks verifies certificate chains at the current time instead of the signed date
+	// and checks their revocation with OCSPRevocationChecker unless RevocationChecker is set.
 	EnableOnlineChecks bool
 
+	// InsecureSkipRootPinning trusts the root certificate carried in the x5c header of signed data
+	// instead of requiring chains to end in RootCertificates. Any self-made chain with the Apple OIDs
+	// is accepted, only use it for testing.
+	InsecureSkipRootPinning bool
+
+	// ChainCacheSize is the number of verified certificate chains cached by the verifier.
+	// Defaults to MaximumCacheSize, caching is disabled if negative.
+	ChainCacheSize int
+
+	// ChainCacheTTL is how long a verified certificate chain is cached, defaults to CacheTimeLimit.
+	// With online checks it bounds how long a revoked certificate may still be accepted.
+	ChainCacheTTL time.Duration
+
+	// RevocationChecker checks the revocation status of certificate chains.
+	// If nil, chains are checked with OCSPRevocationChecker when EnableOnlineChecks is set
+	// and not checked otherwise.
+	RevocationChecker RevocationChecker
+
 	// HTTPClient is the custom HTTP client to use for API requests.
 	// If nil, a default HTTP client will be used.
 	HTTPClient *http.Client
@@ -54,6 +83,32 @@ type ClientConfig struct {
 	// recommended to be true for most use cases.
 	// When false, raw responses are returned and must be verified manually.
 	EnableAutoDecode bool
+
+	// DecodePolicy decides how auto-decode handles invalid signed transactions of
+	// GetTransactionHistory, LookUpOrderID and GetRefundHistory, defaults to DecodePolicyStrict.
+	DecodePolicy DecodePolicy
+
+	// TokenLifetime is the lifetime of the cached API bearer token.
+	// Defaults to DefaultTokenLifetime and is capped at MaxTokenLifetime.
+	TokenLifetime time.Duration
+
+	// RetryPolicy controls retries of failed API requests.
+	// If nil, every request is attempted exactly once.
+	RetryPolicy *RetryPolicy
+
+	// BaseURL overrides the App Store Server API base URL of the configured environment,
+	// e.g. to send requests through an egress proxy or to a local fake server.
+	BaseURL string
+
+	// BaseURLs overrides the App Store Server API base URL per environment,
+	// so the same configuration serves clients of different environments.
+	// BaseURL takes precedence over it.
+	BaseURLs map[Environment]string
+
+	// AcceptedEnvironments are environments whose signed data is accepted in addition to Environment,
+	// e.g. Sandbox for a production verifier that also receives TestFlight and App Review purchases.
+	// AppAppleID is required when it contains Production.
+	AcceptedEnvironments []Environment
 }
 
 // Validate validates the ClientConfig and returns an error if any required field is missing or invalid
@@ -76,43 +131,181 @@ func (c *ClientConfig) Validate() error {
 	if c.Environment == EnvironmentProduction && c.AppAppleID == 0 {
 		return errors.New("appAppleID is required when the environment is Production")
 	}
+	for _, environment := range c.AcceptedEnvironments {
+		if !environment.IsValid() {
+			return fmt.Errorf("invalid accepted environment: %s", environment)
+		}
+		if environment == EnvironmentProduction && c.AppAppleID == 0 {
+			return errors.New("appAppleID is required when Production is accepted")
+		}
+	}
+	if !c.DecodePolicy.IsValid() {
+		return fmt.Errorf("invalid decode policy: %d", c.DecodePolicy)
+	}
+	if c.BaseURL != "" {
+		if err := validateBaseURL(c.BaseURL); err != nil {
+			return err
+		}
+	}
+	for environment, baseURL := range c.BaseURLs {
+		if err := validateBaseURL(baseURL); err != nil {
+			return fmt.Errorf("%s: %w", environment, err)
+		}
+	}
+	return nil
+}
+
+// revocationChecker returns the RevocationChecker of certificate chains, nil to skip revocation checks
+func (c *ClientConfig) revocationChecker() RevocationChecker {
+	if c.RevocationChecker != nil {
+		return c.RevocationChecker
+	}
+	if c.EnableOnlineChecks {
+		return &OCSPRevocationChecker{HTTPClient: c.HTTPClient}
+	}
+	return nil
+}
+
+// ResolveBaseURL returns the base URL requests of the configured environment are sent to
+func (c *ClientConfig) ResolveBaseURL() string {
+	if c.BaseURL != "" {
+		return strings.TrimSuffix(c.BaseURL, "/")
+	}
+	if baseURL, ok := c.BaseURLs[c.Environment]; ok {
+		return strings.TrimSuffix(baseURL, "/")
+	}
+	return c.Environment.BaseURL()
+}
+
+// validateBaseURL checks that raw is an absolute HTTP(S) URL without query or fragment
+func validateBaseURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid base URL %q: %w", raw, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid base URL %q: must be an absolute http or https URL", raw)
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return fmt.Errorf("invalid base URL %q: must not contain a query or fragment", raw)
+	}
 	return nil
 }
 
+// Init sets defaults and downloads the Apple root certificates if RootCertificates is empty
 func (c *ClientConfig) Init() error {
+	return c.InitContext(context.Background())
+}
+
+// InitContext is like Init, the root certificates are downloaded with HTTPClient and ctx
+func (c *ClientConfig) InitContext(ctx context.Context) error {
 	if c.HTTPClient == nil {
 		c.HTTPClient = &http.Client{
 			Timeout: 5 * time.Second,
 		}
 	}
+	if len(c.RootCertificates) == 0 && c.RootCertificatesFS != nil {
+		rootCertificates, err := LoadRootCertificates(c.RootCertificatesFS, ".")
+		if err != nil {
+			return err
+		}
+		c.RootCertificates = rootCertificates
+	}
 	if len(c.RootCertificates) == 0 {
-		for _, v := range []string{AppleRootCAURL, AppleRootCAG2URL, AppleRootCAG3URL} {
-			err := func() error {
-				resp, err := http.Get(v)
-				if err != nil {
-					return fmt.Errorf("failed to download %s: %w", v, err)
-				}
-				defer resp.Body.Close()
-
-				if resp.StatusCode != http.StatusOK {
-					return fmt.Errorf("failed to download %s: HTTP %d", v, resp.StatusCode)
-				}
-
-				certData, err := io.ReadAll(resp.Body)
-				if err != nil {
-					return fmt.Errorf("failed to read certificate data from %s: %w", v, err)
-				}
-
-				c.RootCertificates = append(c.RootCertificates, certData)
-				return nil
-			}()
-			if err != nil {
-				return err
-			}
+		rootCertificates, err := DownloadRootCertificates(ctx, c.HTTPClient)
+		if err != nil {
+			return err
 		}
+		c.RootCertificates = rootCertificates
 	}
 	if c.Environment == "" {
 		c.Environment = EnvironmentSandbox
 	}
 	return nil
 }
+
+//go:embed certs/*.cer
+var appleRootCertificates embed.FS
+
+// AppleRootCertificatesFS returns the Apple Root CA, G2 and G3 certificates embedded in this package,
+// for use as RootCertificatesFS
+func AppleRootCertificatesFS() fs.FS {
+	fsys, err := fs.Sub(appleRootCertificates, "certs")
+	if err != nil {
+		panic(err)
+	}
+	return fsys
+}
+
+// DownloadRootCertificates downloads the Apple root certificates from AppleRootCAURL,
+// AppleRootCAG2URL and AppleRootCAG3URL with httpClient
+func DownloadRootCertificates(ctx context.Context, httpClient *http.Client) ([][]byte, error) {
+	var rootCertificates [][]byte
+	for _, v := range []string{AppleRootCAURL, AppleRootCAG2URL, AppleRootCAG3URL} {
+		certData, err := downloadCertificate(ctx, httpClient, v)
+		if err != nil {
+			return nil, err
+		}
+		rootCertificates = append(rootCertificates, certData)
+	}
+	return rootCertificates, nil
+}
+
+func downloadCertificate(ctx context.Context, httpClient *http.Client, certURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, certURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", certURL, err)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", certURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download %s: HTTP %d", certURL, resp.StatusCode)
+	}
+
+	certData, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certificate data from %s: %w", certURL, err)
+	}
+	return certData, nil
+}
+
+// LoadRootCertificates reads the DER encoded certificates with a .cer or .der extension in dir of fsys,
+// so root certificates embedded with go:embed are used without network I/O
+func LoadRootCertificates(fsys fs.FS, dir string) ([][]byte, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read root certificates: %w", err)
+	}
+
+	var rootCertificates [][]byte
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		switch strings.ToLower(path.Ext(entry.Name())) {
+		case ".cer", ".der":
+		default:
+			continue
+		}
+
+		name := path.Join(dir, entry.Name())
+		certData, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read root certificate %s: %w", name, err)
+		}
+		if _, err := x509.ParseCertificate(certData); err != nil {
+			return nil, fmt.Errorf("failed to parse root certificate %s: %w", name, err)
+		}
+		rootCertificates = append(rootCertificates, certData)
+	}
+
+	if len(rootCertificates) == 0 {
+		return nil, fmt.Errorf("no root certificates found in %s", dir)
+	}
+	return rootCertificates, nil
+}
@@ -0,0 +1,159 @@
+package appstoreserver
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"testing"
+	"testing/fstest"
+)
+
+func TestInitDownloadsWithHTTPClient(t *testing.T) {
+	cert, err := os.ReadFile("../../testdata/certs/testCA.der")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var requested []string
+	config := ClientConfig{
+		Environment: EnvironmentSandbox,
+		HTTPClient: &http.Client{Transport: &mockTransport{
+			RoundTripFunc: func(req *http.Request) (*http.Response, error) {
+				requested = append(requested, req.URL.String())
+				return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewReader(cert))}, nil
+			},
+		}},
+	}
+	if err := config.InitContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{AppleRootCAURL, AppleRootCAG2URL, AppleRootCAG3URL}
+	if len(requested) != len(want) || requested[0] != want[0] || requested[2] != want[2] {
+		t.Fatalf("expected %v, got %v", want, requested)
+	}
+	if len(config.RootCertificates) != 3 {
+		t.Fatalf("expected %d root certificates, got %d", 3, len(config.RootCertificates))
+	}
+}
+
+func TestInitContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	config := ClientConfig{
+		Environment: EnvironmentSandbox,
+		HTTPClient: &http.Client{Transport: &mockTransport{
+			RoundTripFunc: func(req *http.Request) (*http.Response, error) {
+				return nil, req.Context().Err()
+			},
+		}},
+	}
+	if err := config.InitContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected %v, got %v", context.Canceled, err)
+	}
+}
+
+func TestRootCertificatesFS(t *testing.T) {
+	pk, err := os.ReadFile("../../testdata/certs/testSigningKey.p8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := os.ReadFile("../../testdata/certs/testCA.der")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fsys := fstest.MapFS{
+		"AppleRootCA-G3.cer": {Data: cert},
+		"README.md":          {Data: []byte("Apple root certificates")},
+	}
+	client, err := New(
+		WithBundleID("com.example"),
+		WithEnvironment(EnvironmentSandbox),
+		WithKeyID("keyId"),
+		WithIssuerID("issuerId"),
+		WithPrivateKey(pk),
+		WithRootCertificatesFS(fsys),
+		WithHTTPClient(&http.Client{Transport: &mockTransport{
+			RoundTripFunc: func(req *http.Request) (*http.Response, error) {
+				t.Fatalf("unexpected request %s", req.URL)
+				return nil, nil
+			},
+		}}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testNotification, err := os.ReadFile("../../testdata/mock_signed_data/testNotification")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Verifier.VerifyAndDecodeNotification(string(testNotification)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadRootCertificates(fstest.MapFS{"README.md": {Data: []byte("none")}}, "."); err == nil {
+		t.Fatal("expected error but got nil")
+	}
+	if _, err := LoadRootCertificates(fstest.MapFS{"certs/invalid.cer": {Data: []byte("invalid")}}, "certs"); err == nil {
+		t.Fatal("expected error but got nil")
+	}
+}
+
+func TestEmbeddedAppleRootCertificates(t *testing.T) {
+	pk, err := os.ReadFile("../../testdata/certs/testSigningKey.p8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := New(
+		WithBundleID("com.example"),
+		WithEnvironment(EnvironmentSandbox),
+		WithKeyID("keyId"),
+		WithIssuerID("issuerId"),
+		WithPrivateKey(pk),
+		WithEmbeddedAppleRootCertificates(),
+		WithHTTPClient(&http.Client{Transport: &mockTransport{
+			RoundTripFunc: func(req *http.Request) (*http.Response, error) {
+				t.Fatalf("unexpected request %s", req.URL)
+				return nil, nil
+			},
+		}}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client == nil {
+		t.Fatal("expected client but got nil")
+	}
+
+	rootCertificates, err := LoadRootCertificates(AppleRootCertificatesFS(), ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"Apple Root CA":      "b0b1730ecbc7ff4505142c49f1295e6eda6bcaed7e2c68c5be91b5a11001f024",
+		"Apple Root CA - G2": "c2b9b042dd57830e7d117dac55ac8ae19407d38e41d88f3215bc3a890444a050",
+		"Apple Root CA - G3": "63343abfb89a6a03ebb57e9b3f5fa7be7c4f5c756f3017b3a8c488c3653e9179",
+	}
+	if len(rootCertificates) != len(expected) {
+		t.Fatalf("expected %d root certificates, got %d", len(expected), len(rootCertificates))
+	}
+	for _, certData := range rootCertificates {
+		cert, err := x509.ParseCertificate(certData)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sum := sha256.Sum256(certData)
+		if fingerprint := hex.EncodeToString(sum[:]); fingerprint != expected[cert.Subject.CommonName] {
+			t.Fatalf("expected %v, got %v", expected[cert.Subject.CommonName], fingerprint)
+		}
+	}
+}
@@ -69,6 +69,8 @@ const (
 	VerificationStatusInvalidChain
 	// VerificationStatusInvalidEnvironment indicates invalid environment
 	VerificationStatusInvalidEnvironment
+	// VerificationStatusInvalidDeviceVerification indicates the signed data was not issued for the device
+	VerificationStatusInvalidDeviceVerification
 )
 
 // String returns the string representation of verification status
@@ -88,11 +90,35 @@ func (v VerificationStatus) String() string {
 		return "INVALID_CHAIN"
 	case VerificationStatusInvalidEnvironment:
 		return "INVALID_ENVIRONMENT"
+	case VerificationStatusInvalidDeviceVerification:
+		return "INVALID_DEVICE_VERIFICATION"
 	default:
 		return "UNKNOWN"
 	}
 }
 
+// DecodePolicy decides how auto-decoded responses handle signed transactions failing verification
+type DecodePolicy int
+
+const (
+	// DecodePolicyStrict fails the whole response at the first invalid transaction
+	DecodePolicyStrict DecodePolicy = iota
+	// DecodePolicySkipInvalid leaves invalid transactions out of Payloads and reports them in DecodeErrors
+	DecodePolicySkipInvalid
+	// DecodePolicyKeepRaw keeps a nil payload at the index of invalid transactions, so Payloads stays aligned
+	// with SignedTransactions, and reports them in DecodeErrors
+	DecodePolicyKeepRaw
+)
+
+func (p DecodePolicy) IsValid() bool {
+	switch p {
+	case DecodePolicyStrict, DecodePolicySkipInvalid, DecodePolicyKeepRaw:
+		return true
+	default:
+		return false
+	}
+}
+
 // AutoRenewStatus indicates the current renewal status for an auto-renewable subscription.
 // See https://developer.apple.com/documentation/appstoreserverapi/autorenewstatus
 type AutoRenewStatus int
@@ -340,3 +366,18 @@ const (
 	// OfferDiscountTypePayUpFront indicates customers pay up front
 	OfferDiscountTypePayUpFront OfferDiscountType = "PAY_UP_FRONT"
 )
+
+// PurchasePlatform indicates the platform on which the customer originally purchased the app.
+// See https://developer.apple.com/documentation/storekit/appstore/platform
+type PurchasePlatform string
+
+const (
+	// PurchasePlatformIOS indicates the app was purchased on iOS or iPadOS
+	PurchasePlatformIOS PurchasePlatform = "iOS"
+	// PurchasePlatformMacOS indicates the app was purchased on macOS
+	PurchasePlatformMacOS PurchasePlatform = "macOS"
+	// PurchasePlatformTvOS indicates the app was purchased on tvOS
+	PurchasePlatformTvOS PurchasePlatform = "tvOS"
+	// PurchasePlatformVisionOS indicates the app was purchased on visionOS
+	PurchasePlatformVisionOS PurchasePlatform = "visionOS"
+)
@@ -131,6 +131,59 @@ func (j *JWSRenewalInfoDecodedPayload) IsSandbox() bool {
 	return j.Environment == EnvironmentSandbox
 }
 
+// JWSAppTransactionDecodedPayload contains the app transaction information signed by the App Store.
+// See https://developer.apple.com/documentation/storekit/apptransaction
+type JWSAppTransactionDecodedPayload struct {
+	ReceiptType                Environment      `json:"receiptType"`
+	AppAppleID                 int64            `json:"appAppleId,omitempty"`
+	BundleID                   string           `json:"bundleId"`
+	ApplicationVersion         string           `json:"applicationVersion"`
+	VersionExternalIdentifier  int64            `json:"versionExternalIdentifier,omitempty"`
+	ReceiptCreationDate        int64            `json:"receiptCreationDate"`
+	OriginalPurchaseDate       int64            `json:"originalPurchaseDate"`
+	OriginalApplicationVersion string           `json:"originalApplicationVersion"`
+	DeviceVerification         string           `json:"deviceVerification"`
+	DeviceVerificationNonce    string           `json:"deviceVerificationNonce"`
+	PreorderDate               int64            `json:"preorderDate,omitempty"`
+	AppTransactionID           string           `json:"appTransactionId"`
+	OriginalPlatform           PurchasePlatform `json:"originalPlatform"`
+}
+
+// GetReceiptCreationDate returns the receipt creation date as a time.Time
+func (j *JWSAppTransactionDecodedPayload) GetReceiptCreationDate() time.Time {
+	return time.UnixMilli(j.ReceiptCreationDate)
+}
+
+// GetOriginalPurchaseDate returns the original purchase date as a time.Time
+func (j *JWSAppTransactionDecodedPayload) GetOriginalPurchaseDate() time.Time {
+	return time.UnixMilli(j.OriginalPurchaseDate)
+}
+
+// GetPreorderDate returns the preorder date as a time.Time
+func (j *JWSAppTransactionDecodedPayload) GetPreorderDate() time.Time {
+	return time.UnixMilli(j.PreorderDate)
+}
+
+// IsPreorder returns true if the customer preordered the app
+func (j *JWSAppTransactionDecodedPayload) IsPreorder() bool {
+	return j.PreorderDate > 0
+}
+
+// VerifyDevice checks that the app transaction was issued for the device identified by identifierForVendor
+func (j *JWSAppTransactionDecodedPayload) VerifyDevice(identifierForVendor string) error {
+	return VerifyDeviceVerification(j.DeviceVerification, j.DeviceVerificationNonce, identifierForVendor)
+}
+
+// IsProduction returns true if the app transaction was issued in the production environment
+func (j *JWSAppTransactionDecodedPayload) IsProduction() bool {
+	return j.ReceiptType == EnvironmentProduction
+}
+
+// IsSandbox returns true if the app transaction was issued in the sandbox environment
+func (j *JWSAppTransactionDecodedPayload) IsSandbox() bool {
+	return j.ReceiptType == EnvironmentSandbox
+}
+
 // AdvancedCommerceInfo Renewal information that is present only for Advanced Commerce SKUs.
 // See https://developer.apple.com/documentation/appstoreserverapi/advancedcommercerenewalinfo
 type AdvancedCommerceInfo struct {
@@ -443,6 +496,7 @@ type HistoryResponse struct {
 	Environment        Environment                     `json:"environment"`
 	SignedTransactions []string                        `json:"signedTransactions"`
 	Payloads           []*JWSTransactionDecodedPayload `json:"-"`
+	DecodeErrors       []*DecodeError                  `json:"-"`
 }
 
 // OrderLookupResponse includes the order lookup status and an array of signed transactions for the in-app purchases in the order.
@@ -451,6 +505,7 @@ type OrderLookupResponse struct {
 	Status             OrderLookupStatus               `json:"status"`
 	SignedTransactions []string                        `json:"signedTransactions"`
 	Payloads           []*JWSTransactionDecodedPayload `json:"-"`
+	DecodeErrors       []*DecodeError                  `json:"-"`
 }
 
 // RefundHistoryResponse contains an array of signed JSON Web Signature (JWS) refunded transactions, and paging information.
@@ -460,6 +515,7 @@ type RefundHistoryResponse struct {
 	Revision           string                          `json:"revision"`
 	HasMore            bool                            `json:"hasMore"`
 	Payloads           []*JWSTransactionDecodedPayload `json:"-"`
+	DecodeErrors       []*DecodeError                  `json:"-"`
 }
 
 // ExtendRenewalDateResponse indicates whether an individual renewal-date extension succeeded, and related details.
@@ -0,0 +1,253 @@
+// Package entitlements derives subscription access from App Store subscription statuses and notifications
+package entitlements
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	appstoreserver "github.com/gh73962/appleapis/appstoreserver/v1"
+)
+
+// State represents the entitlement state of an auto-renewable subscription
+type State string
+
+const (
+	// StateActive indicates the subscription is active
+	StateActive State = "ACTIVE"
+
+	// StateGracePeriod indicates renewal failed and the customer keeps access during the billing grace period
+	StateGracePeriod State = "GRACE_PERIOD"
+
+	// StateBillingRetry indicates renewal failed and the App Store is retrying billing, the customer has no access
+	StateBillingRetry State = "BILLING_RETRY"
+
+	// StateExpired indicates the subscription expired
+	StateExpired State = "EXPIRED"
+
+	// StateRevoked indicates the App Store refunded or revoked the subscription
+	StateRevoked State = "REVOKED"
+
+	// StateUpgraded indicates the customer upgraded to another subscription in the same group
+	StateUpgraded State = "UPGRADED"
+)
+
+// ErrNotDecoded is returned when a status item has no decoded transaction
+var ErrNotDecoded = errors.New("transaction is not decoded")
+
+// Entitlement is the entitlement state of one subscription
+type Entitlement struct {
+	ProductID                   string
+	SubscriptionGroupIdentifier string
+	OriginalTransactionID       string
+	TransactionID               string
+	State                       State
+	// HasAccess reports whether the customer had access when the entitlement was derived
+	HasAccess bool
+	// ExpiresDate is when access ends: the grace period expiration in the grace period,
+	// the revocation date when revoked, and the transaction expiration otherwise
+	ExpiresDate time.Time
+	// FamilyShared reports whether the customer has access through Family Sharing
+	FamilyShared       bool
+	AutoRenew          bool
+	AutoRenewProductID string
+	ExpirationIntent   appstoreserver.ExpirationIntent
+	RevocationReason   *appstoreserver.RevocationReason
+	// SignedDate is the signed date of the transaction the entitlement was derived from
+	SignedDate int64
+}
+
+// IsActiveAt reports whether the entitlement grants access at t
+func (e *Entitlement) IsActiveAt(t time.Time) bool {
+	if e.State != StateActive && e.State != StateGracePeriod {
+		return false
+	}
+	return e.ExpiresDate.IsZero() || t.Before(e.ExpiresDate)
+}
+
+// Derive derives the entitlement of a subscription from its status, transaction and optional renewal info at now.
+// A zero status, as in notifications without a status, is inferred from the transaction and renewal info.
+func Derive(status appstoreserver.SubscriptionStatus, transaction *appstoreserver.JWSTransactionDecodedPayload, renewalInfo *appstoreserver.JWSRenewalInfoDecodedPayload, now time.Time) Entitlement {
+	e := Entitlement{
+		ProductID:                   transaction.ProductID,
+		SubscriptionGroupIdentifier: transaction.SubscriptionGroupIdentifier,
+		OriginalTransactionID:       transaction.OriginalTransactionID,
+		TransactionID:               transaction.TransactionID,
+		FamilyShared:                transaction.InAppOwnershipType == appstoreserver.InAppOwnershipTypeFamilyShared,
+		RevocationReason:            transaction.RevocationReason,
+		SignedDate:                  transaction.SignedDate,
+	}
+	if transaction.ExpiresDate != 0 {
+		e.ExpiresDate = transaction.GetExpiresDate()
+	}
+	if renewalInfo != nil {
+		e.AutoRenew = renewalInfo.AutoRenewStatus == appstoreserver.AutoRenewStatusOn
+		e.AutoRenewProductID = renewalInfo.AutoRenewProductID
+		e.ExpirationIntent = renewalInfo.ExpirationIntent
+	}
+
+	if status == 0 {
+		status = inferStatus(transaction, renewalInfo, now)
+	}
+
+	switch {
+	case status == appstoreserver.StatusRevoked || transaction.RevocationDate != 0:
+		e.State = StateRevoked
+		if transaction.RevocationDate != 0 {
+			e.ExpiresDate = transaction.GetRevocationDate()
+		}
+	case transaction.IsUpgraded:
+		e.State = StateUpgraded
+	case status == appstoreserver.StatusActive:
+		e.State = StateActive
+	case status == appstoreserver.StatusBillingGracePeriod:
+		e.State = StateGracePeriod
+		if renewalInfo != nil && renewalInfo.GracePeriodExpiresDate != 0 {
+			e.ExpiresDate = renewalInfo.GetGracePeriodExpiresDate()
+		}
+	case status == appstoreserver.StatusBillingRetry:
+		e.State = StateBillingRetry
+	default:
+		e.State = StateExpired
+	}
+
+	e.HasAccess = e.IsActiveAt(now)
+	return e
+}
+
+// inferStatus infers the subscription status from the transaction and renewal info
+func inferStatus(transaction *appstoreserver.JWSTransactionDecodedPayload, renewalInfo *appstoreserver.JWSRenewalInfoDecodedPayload, now time.Time) appstoreserver.SubscriptionStatus {
+	switch {
+	case transaction.RevocationDate != 0:
+		return appstoreserver.StatusRevoked
+	case transaction.ExpiresDate == 0 || now.Before(transaction.GetExpiresDate()):
+		return appstoreserver.StatusActive
+	case renewalInfo != nil && renewalInfo.GracePeriodExpiresDate != 0 && now.Before(renewalInfo.GetGracePeriodExpiresDate()):
+		return appstoreserver.StatusBillingGracePeriod
+	case renewalInfo != nil && renewalInfo.IsInBillingRetryPeriod:
+		return appstoreserver.StatusBillingRetry
+	default:
+		return appstoreserver.StatusExpired
+	}
+}
+
+// better reports whether a should replace b as the entitlement of a product or group
+func better(a, b *Entitlement) bool {
+	if a.HasAccess != b.HasAccess {
+		return a.HasAccess
+	}
+	if !a.ExpiresDate.Equal(b.ExpiresDate) {
+		return a.ExpiresDate.After(b.ExpiresDate)
+	}
+	return a.SignedDate > b.SignedDate
+}
+
+// GroupEntitlement is the entitlement state of a subscription group
+type GroupEntitlement struct {
+	SubscriptionGroupIdentifier string
+	// Current is the entitlement granting access in the group, or the most recent one if none does
+	Current *Entitlement
+	// Entitlements contains the entitlement of every subscription in the group
+	Entitlements []*Entitlement
+}
+
+// Entitlements is the entitlement state of a customer by product and by subscription group
+type Entitlements struct {
+	Products map[string]*Entitlement
+	Groups   map[string]*GroupEntitlement
+}
+
+// New creates empty Entitlements
+func New() *Entitlements {
+	return &Entitlements{
+		Products: make(map[string]*Entitlement),
+		Groups:   make(map[string]*GroupEntitlement),
+	}
+}
+
+// FromStatusResponse derives Entitlements from a decoded StatusResponse at now.
+// It returns ErrNotDecoded if the client did not decode the signed transactions.
+func FromStatusResponse(response *appstoreserver.StatusResponse, now time.Time) (*Entitlements, error) {
+	entitlements := New()
+	for _, group := range response.Data {
+		for _, item := range group.LastTransactions {
+			if item.TransactionPayload == nil {
+				return nil, fmt.Errorf("original transaction %s: %w", item.OriginalTransactionID, ErrNotDecoded)
+			}
+			e := Derive(item.Status, item.TransactionPayload, item.RenewalPayload, now)
+			if e.SubscriptionGroupIdentifier == "" {
+				e.SubscriptionGroupIdentifier = group.SubscriptionGroupIdentifier
+			}
+			entitlements.Set(&e)
+		}
+	}
+	return entitlements, nil
+}
+
+// Set adds or replaces the entitlement of its original transaction and updates the product and group state
+func (s *Entitlements) Set(e *Entitlement) {
+	group, ok := s.Groups[e.SubscriptionGroupIdentifier]
+	if !ok {
+		group = &GroupEntitlement{SubscriptionGroupIdentifier: e.SubscriptionGroupIdentifier}
+		s.Groups[e.SubscriptionGroupIdentifier] = group
+	}
+
+	replaced := false
+	for i, existing := range group.Entitlements {
+		if existing.OriginalTransactionID == e.OriginalTransactionID {
+			group.Entitlements[i] = e
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		group.Entitlements = append(group.Entitlements, e)
+	}
+
+	group.Current = nil
+	for _, existing := range group.Entitlements {
+		if group.Current == nil || better(existing, group.Current) {
+			group.Current = existing
+		}
+	}
+
+	clear(s.Products)
+	for _, g := range s.Groups {
+		for _, existing := range g.Entitlements {
+			if current, ok := s.Products[existing.ProductID]; !ok || better(existing, current) {
+				s.Products[existing.ProductID] = existing
+			}
+		}
+	}
+}
+
+// Apply updates the entitlements with a verified notification at now.
+// Notifications without a transaction and transactions signed before the current one are ignored.
+// It returns the updated entitlement, or nil if the notification was ignored.
+func (s *Entitlements) Apply(notification *appstoreserver.Notification, now time.Time) *Entitlement {
+	if notification.Transaction == nil {
+		return nil
+	}
+
+	if group, ok := s.Groups[notification.Transaction.SubscriptionGroupIdentifier]; ok {
+		for _, existing := range group.Entitlements {
+			if existing.OriginalTransactionID == notification.Transaction.OriginalTransactionID && existing.SignedDate > notification.Transaction.SignedDate {
+				return nil
+			}
+		}
+	}
+
+	var status appstoreserver.SubscriptionStatus
+	if notification.Payload != nil && notification.Payload.Data != nil {
+		status = appstoreserver.SubscriptionStatus(notification.Payload.Data.Status)
+	}
+	e := Derive(status, notification.Transaction, notification.RenewalInfo, now)
+	s.Set(&e)
+	return &e
+}
+
+// HasAccess reports whether any subscription in the group grants access at t
+func (s *Entitlements) HasAccess(subscriptionGroupIdentifier string, t time.Time) bool {
+	group, ok := s.Groups[subscriptionGroupIdentifier]
+	return ok && group.Current != nil && group.Current.IsActiveAt(t)
+}
@@ -0,0 +1,299 @@
+package entitlements
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	appstoreserver "github.com/gh73962/appleapis/appstoreserver/v1"
+	"github.com/gh73962/appleapis/appstoreservernotifications/v2"
+)
+
+var testNow = time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+func testTransaction(productID, originalTransactionID string, expiresDate time.Time) *appstoreserver.JWSTransactionDecodedPayload {
+	return &appstoreserver.JWSTransactionDecodedPayload{
+		ProductID:                   productID,
+		SubscriptionGroupIdentifier: "group",
+		OriginalTransactionID:       originalTransactionID,
+		TransactionID:               originalTransactionID + "_latest",
+		InAppOwnershipType:          appstoreserver.InAppOwnershipTypePurchased,
+		ExpiresDate:                 expiresDate.UnixMilli(),
+		SignedDate:                  testNow.UnixMilli(),
+	}
+}
+
+func TestDeriveStatusCombinations(t *testing.T) {
+	statuses := []appstoreserver.SubscriptionStatus{
+		appstoreserver.StatusActive,
+		appstoreserver.StatusExpired,
+		appstoreserver.StatusBillingRetry,
+		appstoreserver.StatusBillingGracePeriod,
+		appstoreserver.StatusRevoked,
+	}
+	intents := []appstoreserver.ExpirationIntent{
+		0,
+		appstoreserver.ExpirationIntentCustomerCanceled,
+		appstoreserver.ExpirationIntentBillingError,
+		appstoreserver.ExpirationIntentDidNotConsentToPriceIncrease,
+		appstoreserver.ExpirationIntentProductNotAvailable,
+		appstoreserver.ExpirationIntentOther,
+	}
+	otherIssue, appIssue := appstoreserver.RevocationReasonOtherIssue, appstoreserver.RevocationReasonAppIssue
+	reasons := []*appstoreserver.RevocationReason{nil, &otherIssue, &appIssue}
+
+	wantStates := map[appstoreserver.SubscriptionStatus]struct {
+		state     State
+		hasAccess bool
+	}{
+		appstoreserver.StatusActive:             {StateActive, true},
+		appstoreserver.StatusExpired:            {StateExpired, false},
+		appstoreserver.StatusBillingRetry:       {StateBillingRetry, false},
+		appstoreserver.StatusBillingGracePeriod: {StateGracePeriod, true},
+		appstoreserver.StatusRevoked:            {StateRevoked, false},
+	}
+
+	for _, status := range statuses {
+		for _, intent := range intents {
+			for _, reason := range reasons {
+				name := fmt.Sprintf("status=%d/intent=%d/reason=%v", status, intent, reason)
+				t.Run(name, func(t *testing.T) {
+					expiresDate := testNow.Add(24 * time.Hour)
+					if status != appstoreserver.StatusActive {
+						expiresDate = testNow.Add(-24 * time.Hour)
+					}
+					transaction := testTransaction("monthly", "1000", expiresDate)
+					transaction.RevocationReason = reason
+					revocationDate := testNow.Add(-time.Hour)
+					if reason != nil {
+						transaction.RevocationDate = revocationDate.UnixMilli()
+					}
+					renewalInfo := &appstoreserver.JWSRenewalInfoDecodedPayload{
+						ProductID:              "monthly",
+						AutoRenewProductID:     "monthly",
+						AutoRenewStatus:        appstoreserver.AutoRenewStatusOn,
+						ExpirationIntent:       intent,
+						IsInBillingRetryPeriod: status == appstoreserver.StatusBillingRetry || status == appstoreserver.StatusBillingGracePeriod,
+						GracePeriodExpiresDate: testNow.Add(6 * 24 * time.Hour).UnixMilli(),
+					}
+					if status != appstoreserver.StatusBillingGracePeriod {
+						renewalInfo.GracePeriodExpiresDate = 0
+					}
+
+					e := Derive(status, transaction, renewalInfo, testNow)
+
+					want := wantStates[status]
+					if reason != nil {
+						want.state, want.hasAccess = StateRevoked, false
+					}
+					if e.State != want.state {
+						t.Fatalf("expected %q, got %q", want.state, e.State)
+					}
+					if e.HasAccess != want.hasAccess {
+						t.Fatalf("expected %v, got %v", want.hasAccess, e.HasAccess)
+					}
+					if e.ExpirationIntent != intent {
+						t.Fatalf("expected %d, got %d", intent, e.ExpirationIntent)
+					}
+					if e.RevocationReason != reason {
+						t.Fatalf("expected %v, got %v", reason, e.RevocationReason)
+					}
+
+					wantExpires := expiresDate.UnixMilli()
+					switch {
+					case reason != nil:
+						wantExpires = revocationDate.UnixMilli()
+					case status == appstoreserver.StatusBillingGracePeriod:
+						wantExpires = renewalInfo.GracePeriodExpiresDate
+					}
+					if e.ExpiresDate.UnixMilli() != wantExpires {
+						t.Fatalf("expected %d, got %d", wantExpires, e.ExpiresDate.UnixMilli())
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestDerive(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       appstoreserver.SubscriptionStatus
+		transaction  func() *appstoreserver.JWSTransactionDecodedPayload
+		renewalInfo  *appstoreserver.JWSRenewalInfoDecodedPayload
+		wantState    State
+		wantAccess   bool
+		familyShared bool
+	}{
+		{
+			name:   "upgraded",
+			status: appstoreserver.StatusActive,
+			transaction: func() *appstoreserver.JWSTransactionDecodedPayload {
+				transaction := testTransaction("monthly", "1000", testNow.Add(time.Hour))
+				transaction.IsUpgraded = true
+				return transaction
+			},
+			wantState: StateUpgraded,
+		},
+		{
+			name:   "family shared",
+			status: appstoreserver.StatusActive,
+			transaction: func() *appstoreserver.JWSTransactionDecodedPayload {
+				transaction := testTransaction("monthly", "1000", testNow.Add(time.Hour))
+				transaction.InAppOwnershipType = appstoreserver.InAppOwnershipTypeFamilyShared
+				return transaction
+			},
+			wantState:    StateActive,
+			wantAccess:   true,
+			familyShared: true,
+		},
+		{
+			name:   "active status past expiration",
+			status: appstoreserver.StatusActive,
+			transaction: func() *appstoreserver.JWSTransactionDecodedPayload {
+				return testTransaction("monthly", "1000", testNow.Add(-time.Minute))
+			},
+			wantState: StateActive,
+		},
+		{
+			name: "inferred active",
+			transaction: func() *appstoreserver.JWSTransactionDecodedPayload {
+				return testTransaction("monthly", "1000", testNow.Add(time.Hour))
+			},
+			wantState:  StateActive,
+			wantAccess: true,
+		},
+		{
+			name: "inferred grace period",
+			transaction: func() *appstoreserver.JWSTransactionDecodedPayload {
+				return testTransaction("monthly", "1000", testNow.Add(-time.Hour))
+			},
+			renewalInfo: &appstoreserver.JWSRenewalInfoDecodedPayload{
+				IsInBillingRetryPeriod: true,
+				GracePeriodExpiresDate: testNow.Add(time.Hour).UnixMilli(),
+			},
+			wantState:  StateGracePeriod,
+			wantAccess: true,
+		},
+		{
+			name: "inferred billing retry",
+			transaction: func() *appstoreserver.JWSTransactionDecodedPayload {
+				return testTransaction("monthly", "1000", testNow.Add(-time.Hour))
+			},
+			renewalInfo: &appstoreserver.JWSRenewalInfoDecodedPayload{IsInBillingRetryPeriod: true},
+			wantState:   StateBillingRetry,
+		},
+		{
+			name: "inferred expired",
+			transaction: func() *appstoreserver.JWSTransactionDecodedPayload {
+				return testTransaction("monthly", "1000", testNow.Add(-time.Hour))
+			},
+			wantState: StateExpired,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := Derive(tt.status, tt.transaction(), tt.renewalInfo, testNow)
+			if e.State != tt.wantState {
+				t.Fatalf("expected %q, got %q", tt.wantState, e.State)
+			}
+			if e.HasAccess != tt.wantAccess {
+				t.Fatalf("expected %v, got %v", tt.wantAccess, e.HasAccess)
+			}
+			if e.FamilyShared != tt.familyShared {
+				t.Fatalf("expected %v, got %v", tt.familyShared, e.FamilyShared)
+			}
+		})
+	}
+}
+
+func TestFromStatusResponse(t *testing.T) {
+	upgraded := testTransaction("monthly", "1000", testNow.Add(time.Hour))
+	upgraded.IsUpgraded = true
+
+	response := &appstoreserver.StatusResponse{
+		Data: []appstoreserver.SubscriptionGroupIdentifierItem{
+			{
+				SubscriptionGroupIdentifier: "group",
+				LastTransactions: []appstoreserver.LastTransactionsItem{
+					{Status: appstoreserver.StatusActive, OriginalTransactionID: "1000", TransactionPayload: upgraded},
+					{Status: appstoreserver.StatusActive, OriginalTransactionID: "2000", TransactionPayload: testTransaction("yearly", "2000", testNow.Add(365*24*time.Hour))},
+				},
+			},
+			{
+				SubscriptionGroupIdentifier: "other",
+				LastTransactions: []appstoreserver.LastTransactionsItem{
+					{Status: appstoreserver.StatusExpired, OriginalTransactionID: "3000", TransactionPayload: &appstoreserver.JWSTransactionDecodedPayload{
+						ProductID:             "other",
+						OriginalTransactionID: "3000",
+						ExpiresDate:           testNow.Add(-time.Hour).UnixMilli(),
+					}},
+				},
+			},
+		},
+	}
+
+	entitlements, err := FromStatusResponse(response, testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if entitlements.Products["monthly"].State != StateUpgraded {
+		t.Fatalf("expected %q, got %q", StateUpgraded, entitlements.Products["monthly"].State)
+	}
+	if current := entitlements.Groups["group"].Current; current.ProductID != "yearly" || !current.HasAccess {
+		t.Fatalf("expected yearly to grant access, got %+v", current)
+	}
+	if !entitlements.HasAccess("group", testNow) {
+		t.Fatal("expected access to group")
+	}
+	if entitlements.HasAccess("other", testNow) {
+		t.Fatal("expected no access to other")
+	}
+	if group := entitlements.Groups["other"]; group == nil || group.Current.State != StateExpired {
+		t.Fatalf("expected expired group from the response identifier, got %+v", group)
+	}
+
+	response.Data[0].LastTransactions[0].TransactionPayload = nil
+	if _, err := FromStatusResponse(response, testNow); !errors.Is(err, ErrNotDecoded) {
+		t.Fatalf("expected %v, got %v", ErrNotDecoded, err)
+	}
+}
+
+func TestApply(t *testing.T) {
+	entitlements := New()
+
+	transaction := testTransaction("monthly", "1000", testNow.Add(time.Hour))
+	e := entitlements.Apply(&appstoreserver.Notification{
+		Payload:     &appstoreservernotifications.DecodedPayload{Data: &appstoreservernotifications.Data{Status: int(appstoreserver.StatusActive)}},
+		Transaction: transaction,
+	}, testNow)
+	if e == nil || e.State != StateActive {
+		t.Fatalf("expected active entitlement, got %+v", e)
+	}
+
+	stale := testTransaction("monthly", "1000", testNow.Add(-time.Hour))
+	stale.SignedDate = transaction.SignedDate - 1
+	if e := entitlements.Apply(&appstoreserver.Notification{Transaction: stale}, testNow); e != nil {
+		t.Fatalf("expected stale notification to be ignored, got %+v", e)
+	}
+	if !entitlements.HasAccess("group", testNow) {
+		t.Fatal("expected access to group")
+	}
+
+	refunded := testTransaction("monthly", "1000", testNow.Add(time.Hour))
+	refunded.SignedDate = transaction.SignedDate + 1
+	refunded.RevocationDate = testNow.UnixMilli()
+	if e := entitlements.Apply(&appstoreserver.Notification{Transaction: refunded}, testNow); e == nil || e.State != StateRevoked {
+		t.Fatalf("expected revoked entitlement, got %+v", e)
+	}
+	if entitlements.HasAccess("group", testNow) {
+		t.Fatal("expected no access to group")
+	}
+
+	if e := entitlements.Apply(&appstoreserver.Notification{}, testNow); e != nil {
+		t.Fatalf("expected notification without transaction to be ignored, got %+v", e)
+	}
+}
@@ -0,0 +1,176 @@
+package entitlements
+
+import (
+	"errors"
+	"fmt"
+
+	appstoreserver "github.com/gh73962/appleapis/appstoreserver/v1"
+	"github.com/gh73962/appleapis/appstoreservernotifications/v2"
+)
+
+// LifecycleState represents the lifecycle state of an auto-renewable subscription
+type LifecycleState string
+
+const (
+	// LifecycleUnknown indicates no notification was applied yet
+	LifecycleUnknown LifecycleState = ""
+
+	// LifecycleTrial indicates the subscription is in a free trial
+	LifecycleTrial LifecycleState = "TRIAL"
+
+	// LifecycleActive indicates the subscription is active and renews automatically
+	LifecycleActive LifecycleState = "ACTIVE"
+
+	// LifecycleAutoRenewDisabled indicates the subscription is active until it expires, auto-renewal is turned off
+	LifecycleAutoRenewDisabled LifecycleState = "AUTO_RENEW_DISABLED"
+
+	// LifecycleUpgraded indicates the customer upgraded, the new subscription is active immediately
+	LifecycleUpgraded LifecycleState = "UPGRADED"
+
+	// LifecycleDowngraded indicates the customer downgraded, the new subscription starts at the next renewal
+	LifecycleDowngraded LifecycleState = "DOWNGRADED"
+
+	// LifecycleGracePeriod indicates renewal failed and the customer keeps access during the billing grace period
+	LifecycleGracePeriod LifecycleState = "GRACE_PERIOD"
+
+	// LifecycleBillingRetry indicates renewal failed and the App Store is retrying billing
+	LifecycleBillingRetry LifecycleState = "BILLING_RETRY"
+
+	// LifecycleExpired indicates the subscription expired
+	LifecycleExpired LifecycleState = "EXPIRED"
+
+	// LifecycleRefunded indicates the App Store refunded the subscription
+	LifecycleRefunded LifecycleState = "REFUNDED"
+
+	// LifecycleRevoked indicates access through Family Sharing was revoked
+	LifecycleRevoked LifecycleState = "REVOKED"
+)
+
+// ErrOutOfOrder is returned when a notification was signed before the last applied one
+var ErrOutOfOrder = errors.New("notification is out of order")
+
+// Transition records a lifecycle state change caused by a notification
+type Transition struct {
+	OriginalTransactionID string                                       `json:"originalTransactionId"`
+	From                  LifecycleState                               `json:"from"`
+	To                    LifecycleState                               `json:"to"`
+	NotificationUUID      string                                       `json:"notificationUUID"`
+	NotificationType      appstoreservernotifications.NotificationType `json:"notificationType"`
+	Subtype               appstoreservernotifications.Subtype          `json:"subtype,omitempty"`
+	SignedDate            int64                                        `json:"signedDate"`
+	// OutOfOrder reports whether the notification was signed before the last applied one and was not applied
+	OutOfOrder bool `json:"outOfOrder,omitempty"`
+}
+
+// Lifecycle is the lifecycle state machine of one auto-renewable subscription, identified by its original transaction
+type Lifecycle struct {
+	OriginalTransactionID string         `json:"originalTransactionId"`
+	ProductID             string         `json:"productId,omitempty"`
+	State                 LifecycleState `json:"state"`
+	// LastSignedDate is the signed date of the last applied notification
+	LastSignedDate int64 `json:"lastSignedDate"`
+}
+
+// NewLifecycle creates a new Lifecycle in the LifecycleUnknown state
+func NewLifecycle(originalTransactionID string) *Lifecycle {
+	return &Lifecycle{OriginalTransactionID: originalTransactionID}
+}
+
+// Apply applies a verified notification and returns the resulting transition.
+// It returns nil if the notification does not affect the lifecycle. A notification signed before the last
+// applied one is not applied, Apply returns a transition flagged OutOfOrder together with ErrOutOfOrder,
+// so callers can either reject it or store the flagged transition.
+func (l *Lifecycle) Apply(notification *appstoreserver.Notification) (*Transition, error) {
+	payload := notification.Payload
+	if payload == nil {
+		return nil, errors.New("notification has no payload")
+	}
+	if transaction := notification.Transaction; transaction != nil && l.OriginalTransactionID != "" && transaction.OriginalTransactionID != l.OriginalTransactionID {
+		return nil, fmt.Errorf("notification for original transaction %s applied to %s", transaction.OriginalTransactionID, l.OriginalTransactionID)
+	}
+
+	next, ok := nextLifecycleState(l.State, payload.NotificationType, payload.Subtype, notification.Transaction)
+	if !ok {
+		return nil, nil
+	}
+
+	transition := Transition{
+		OriginalTransactionID: l.OriginalTransactionID,
+		From:                  l.State,
+		To:                    next,
+		NotificationUUID:      payload.NotificationUUID,
+		NotificationType:      payload.NotificationType,
+		Subtype:               payload.Subtype,
+		SignedDate:            payload.SignedDate,
+	}
+
+	if payload.SignedDate < l.LastSignedDate {
+		transition.To = l.State
+		transition.OutOfOrder = true
+		return &transition, ErrOutOfOrder
+	}
+
+	if notification.Transaction != nil {
+		l.OriginalTransactionID = notification.Transaction.OriginalTransactionID
+		l.ProductID = notification.Transaction.ProductID
+		transition.OriginalTransactionID = l.OriginalTransactionID
+	}
+	l.State = next
+	l.LastSignedDate = payload.SignedDate
+	return &transition, nil
+}
+
+// nextLifecycleState returns the state after a notification, or false if the notification does not affect the lifecycle
+func nextLifecycleState(current LifecycleState, notificationType appstoreservernotifications.NotificationType, subtype appstoreservernotifications.Subtype, transaction *appstoreserver.JWSTransactionDecodedPayload) (LifecycleState, bool) {
+	switch notificationType {
+	case appstoreservernotifications.TypeSubscribed,
+		appstoreservernotifications.TypeDidRenew,
+		appstoreservernotifications.TypeRenewalExtended,
+		appstoreservernotifications.TypeRefundReversed:
+		return activeLifecycleState(transaction), true
+	case appstoreservernotifications.TypeOfferRedeemed, appstoreservernotifications.TypeDidChangeRenewalPref:
+		switch subtype {
+		case appstoreservernotifications.SubtypeUpgrade:
+			return LifecycleUpgraded, true
+		case appstoreservernotifications.SubtypeDowngrade:
+			return LifecycleDowngraded, true
+		}
+		if notificationType == appstoreservernotifications.TypeDidChangeRenewalPref && current != LifecycleDowngraded {
+			return current, true
+		}
+		return activeLifecycleState(transaction), true
+	case appstoreservernotifications.TypeDidChangeRenewalStatus:
+		if subtype == appstoreservernotifications.SubtypeAutoRenewDisabled {
+			return LifecycleAutoRenewDisabled, true
+		}
+		// Turning auto-renew back on doesn't settle billing, only a disabled subscription becomes active again
+		if current == LifecycleAutoRenewDisabled {
+			return activeLifecycleState(transaction), true
+		}
+		return current, true
+	case appstoreservernotifications.TypeDidFailToRenew:
+		if subtype == appstoreservernotifications.SubtypeGracePeriod {
+			return LifecycleGracePeriod, true
+		}
+		return LifecycleBillingRetry, true
+	case appstoreservernotifications.TypeGracePeriodExpired:
+		return LifecycleBillingRetry, true
+	case appstoreservernotifications.TypeExpired:
+		return LifecycleExpired, true
+	case appstoreservernotifications.TypeRefund:
+		return LifecycleRefunded, true
+	case appstoreservernotifications.TypeRevoke:
+		return LifecycleRevoked, true
+	default:
+		return current, false
+	}
+}
+
+// activeLifecycleState returns LifecycleTrial for free trial transactions and LifecycleActive otherwise
+func activeLifecycleState(transaction *appstoreserver.JWSTransactionDecodedPayload) LifecycleState {
+	if transaction != nil && transaction.OfferType == appstoreserver.OfferTypeIntroductory &&
+		transaction.OfferDiscountType == appstoreserver.OfferDiscountTypeFreeTrial {
+		return LifecycleTrial
+	}
+	return LifecycleActive
+}
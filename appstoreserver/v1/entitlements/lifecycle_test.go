@@ -0,0 +1,153 @@
+package entitlements
+
+import (
+	"errors"
+	"testing"
+
+	appstoreserver "github.com/gh73962/appleapis/appstoreserver/v1"
+	"github.com/gh73962/appleapis/appstoreservernotifications/v2"
+)
+
+func testNotification(notificationType appstoreservernotifications.NotificationType, subtype appstoreservernotifications.Subtype, signedDate int64) *appstoreserver.Notification {
+	return &appstoreserver.Notification{
+		Payload: &appstoreservernotifications.DecodedPayload{
+			NotificationType: notificationType,
+			Subtype:          subtype,
+			NotificationUUID: string(notificationType) + "_" + string(subtype),
+			SignedDate:       signedDate,
+		},
+		Transaction: &appstoreserver.JWSTransactionDecodedPayload{
+			OriginalTransactionID: "1000",
+			ProductID:             "monthly",
+		},
+	}
+}
+
+func TestLifecycleTransitions(t *testing.T) {
+	tests := []struct {
+		name             string
+		from             LifecycleState
+		notificationType appstoreservernotifications.NotificationType
+		subtype          appstoreservernotifications.Subtype
+		freeTrial        bool
+		want             LifecycleState
+	}{
+		{"initial buy", LifecycleUnknown, appstoreservernotifications.TypeSubscribed, appstoreservernotifications.SubtypeInitialBuy, false, LifecycleActive},
+		{"initial buy with free trial", LifecycleUnknown, appstoreservernotifications.TypeSubscribed, appstoreservernotifications.SubtypeInitialBuy, true, LifecycleTrial},
+		{"resubscribe", LifecycleExpired, appstoreservernotifications.TypeSubscribed, appstoreservernotifications.SubtypeResubscribe, false, LifecycleActive},
+		{"renew after trial", LifecycleTrial, appstoreservernotifications.TypeDidRenew, "", false, LifecycleActive},
+		{"billing recovery", LifecycleBillingRetry, appstoreservernotifications.TypeDidRenew, appstoreservernotifications.SubtypeBillingRecovery, false, LifecycleActive},
+		{"auto renew disabled", LifecycleActive, appstoreservernotifications.TypeDidChangeRenewalStatus, appstoreservernotifications.SubtypeAutoRenewDisabled, false, LifecycleAutoRenewDisabled},
+		{"auto renew enabled", LifecycleAutoRenewDisabled, appstoreservernotifications.TypeDidChangeRenewalStatus, appstoreservernotifications.SubtypeAutoRenewEnabled, false, LifecycleActive},
+		{"auto renew enabled during trial", LifecycleAutoRenewDisabled, appstoreservernotifications.TypeDidChangeRenewalStatus, appstoreservernotifications.SubtypeAutoRenewEnabled, true, LifecycleTrial},
+		{"auto renew enabled in billing retry", LifecycleBillingRetry, appstoreservernotifications.TypeDidChangeRenewalStatus, appstoreservernotifications.SubtypeAutoRenewEnabled, false, LifecycleBillingRetry},
+		{"auto renew enabled in grace period", LifecycleGracePeriod, appstoreservernotifications.TypeDidChangeRenewalStatus, appstoreservernotifications.SubtypeAutoRenewEnabled, false, LifecycleGracePeriod},
+		{"auto renew enabled when expired", LifecycleExpired, appstoreservernotifications.TypeDidChangeRenewalStatus, appstoreservernotifications.SubtypeAutoRenewEnabled, false, LifecycleExpired},
+		{"upgrade", LifecycleActive, appstoreservernotifications.TypeDidChangeRenewalPref, appstoreservernotifications.SubtypeUpgrade, false, LifecycleUpgraded},
+		{"downgrade", LifecycleActive, appstoreservernotifications.TypeDidChangeRenewalPref, appstoreservernotifications.SubtypeDowngrade, false, LifecycleDowngraded},
+		{"downgrade canceled", LifecycleDowngraded, appstoreservernotifications.TypeDidChangeRenewalPref, "", false, LifecycleActive},
+		{"renewal pref without change", LifecycleAutoRenewDisabled, appstoreservernotifications.TypeDidChangeRenewalPref, "", false, LifecycleAutoRenewDisabled},
+		{"offer redeemed upgrade", LifecycleActive, appstoreservernotifications.TypeOfferRedeemed, appstoreservernotifications.SubtypeUpgrade, false, LifecycleUpgraded},
+		{"offer redeemed", LifecycleAutoRenewDisabled, appstoreservernotifications.TypeOfferRedeemed, "", false, LifecycleActive},
+		{"fail to renew with grace period", LifecycleActive, appstoreservernotifications.TypeDidFailToRenew, appstoreservernotifications.SubtypeGracePeriod, false, LifecycleGracePeriod},
+		{"fail to renew", LifecycleActive, appstoreservernotifications.TypeDidFailToRenew, "", false, LifecycleBillingRetry},
+		{"grace period expired", LifecycleGracePeriod, appstoreservernotifications.TypeGracePeriodExpired, "", false, LifecycleBillingRetry},
+		{"expired voluntary", LifecycleAutoRenewDisabled, appstoreservernotifications.TypeExpired, appstoreservernotifications.SubtypeVoluntary, false, LifecycleExpired},
+		{"expired billing retry", LifecycleBillingRetry, appstoreservernotifications.TypeExpired, appstoreservernotifications.SubtypeBillingRetry, false, LifecycleExpired},
+		{"refund", LifecycleActive, appstoreservernotifications.TypeRefund, "", false, LifecycleRefunded},
+		{"refund reversed", LifecycleRefunded, appstoreservernotifications.TypeRefundReversed, "", false, LifecycleActive},
+		{"revoke", LifecycleActive, appstoreservernotifications.TypeRevoke, "", false, LifecycleRevoked},
+		{"renewal extended", LifecycleBillingRetry, appstoreservernotifications.TypeRenewalExtended, "", false, LifecycleActive},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lifecycle := &Lifecycle{OriginalTransactionID: "1000", State: tt.from, LastSignedDate: 1}
+			notification := testNotification(tt.notificationType, tt.subtype, 2)
+			if tt.freeTrial {
+				notification.Transaction.OfferType = appstoreserver.OfferTypeIntroductory
+				notification.Transaction.OfferDiscountType = appstoreserver.OfferDiscountTypeFreeTrial
+			}
+
+			transition, err := lifecycle.Apply(notification)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if transition == nil {
+				t.Fatal("expected transition, got nil")
+			}
+			if transition.From != tt.from || transition.To != tt.want || lifecycle.State != tt.want {
+				t.Fatalf("expected %q -> %q, got %q -> %q (state %q)", tt.from, tt.want, transition.From, transition.To, lifecycle.State)
+			}
+			if transition.NotificationType != tt.notificationType || transition.Subtype != tt.subtype || transition.SignedDate != 2 {
+				t.Fatalf("expected transition to record the notification, got %+v", transition)
+			}
+			if lifecycle.LastSignedDate != 2 {
+				t.Fatalf("expected %d, got %d", 2, lifecycle.LastSignedDate)
+			}
+		})
+	}
+}
+
+func TestLifecycleIgnoresUnrelatedNotifications(t *testing.T) {
+	lifecycle := &Lifecycle{OriginalTransactionID: "1000", State: LifecycleActive, LastSignedDate: 1}
+
+	for _, notificationType := range []appstoreservernotifications.NotificationType{
+		appstoreservernotifications.TypeConsumptionRequest,
+		appstoreservernotifications.TypePriceIncrease,
+		appstoreservernotifications.TypeRefundDeclined,
+		appstoreservernotifications.TypeTest,
+		"NEW_TYPE",
+	} {
+		transition, err := lifecycle.Apply(testNotification(notificationType, "", 2))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if transition != nil {
+			t.Fatalf("%s: expected nil, got %+v", notificationType, transition)
+		}
+	}
+	if lifecycle.State != LifecycleActive || lifecycle.LastSignedDate != 1 {
+		t.Fatalf("expected unchanged lifecycle, got %+v", lifecycle)
+	}
+}
+
+func TestLifecycleOutOfOrder(t *testing.T) {
+	lifecycle := NewLifecycle("1000")
+
+	events := []*appstoreserver.Notification{
+		testNotification(appstoreservernotifications.TypeSubscribed, appstoreservernotifications.SubtypeInitialBuy, 100),
+		testNotification(appstoreservernotifications.TypeExpired, appstoreservernotifications.SubtypeVoluntary, 300),
+		testNotification(appstoreservernotifications.TypeDidChangeRenewalStatus, appstoreservernotifications.SubtypeAutoRenewDisabled, 200),
+	}
+
+	var transitions []*Transition
+	for i, event := range events {
+		transition, err := lifecycle.Apply(event)
+		if i < 2 && err != nil {
+			t.Fatal(err)
+		}
+		if i == 2 && !errors.Is(err, ErrOutOfOrder) {
+			t.Fatalf("expected %v, got %v", ErrOutOfOrder, err)
+		}
+		transitions = append(transitions, transition)
+	}
+
+	if lifecycle.State != LifecycleExpired || lifecycle.LastSignedDate != 300 {
+		t.Fatalf("expected expired lifecycle at 300, got %+v", lifecycle)
+	}
+	if transitions[0].From != LifecycleUnknown || transitions[0].To != LifecycleActive {
+		t.Fatalf("expected unknown -> active, got %+v", transitions[0])
+	}
+	flagged := transitions[2]
+	if !flagged.OutOfOrder || flagged.From != LifecycleExpired || flagged.To != LifecycleExpired {
+		t.Fatalf("expected flagged transition without state change, got %+v", flagged)
+	}
+}
+
+func TestLifecycleRejectsOtherTransaction(t *testing.T) {
+	lifecycle := NewLifecycle("2000")
+	if _, err := lifecycle.Apply(testNotification(appstoreservernotifications.TypeSubscribed, appstoreservernotifications.SubtypeInitialBuy, 1)); err == nil {
+		t.Fatal("expected error but got nil")
+	}
+}
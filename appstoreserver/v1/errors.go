@@ -4,13 +4,231 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
 )
 
+// APIErrorCode is an error code returned by the App Store Server API.
+// The codes implement error so they can be used as sentinels with errors.Is.
+// See https://developer.apple.com/documentation/appstoreserverapi/error_codes
+type APIErrorCode int
+
+const (
+	// ErrGeneralBadRequest indicates an invalid request
+	ErrGeneralBadRequest APIErrorCode = 4000000
+	// ErrInvalidAppIdentifier indicates an invalid app identifier
+	ErrInvalidAppIdentifier APIErrorCode = 4000002
+	// ErrInvalidRequestRevision indicates an invalid request revision
+	ErrInvalidRequestRevision APIErrorCode = 4000005
+	// ErrInvalidTransactionID indicates an invalid transaction identifier
+	ErrInvalidTransactionID APIErrorCode = 4000006
+	// ErrInvalidOriginalTransactionID indicates an invalid original transaction identifier
+	ErrInvalidOriginalTransactionID APIErrorCode = 4000008
+	// ErrInvalidExtendByDays indicates an invalid extend-by-days value
+	ErrInvalidExtendByDays APIErrorCode = 4000009
+	// ErrInvalidExtendReasonCode indicates an invalid reason code
+	ErrInvalidExtendReasonCode APIErrorCode = 4000010
+	// ErrInvalidRequestIdentifier indicates an invalid request identifier
+	ErrInvalidRequestIdentifier APIErrorCode = 4000011
+	// ErrStartDateTooFarInPast indicates that the start date is earlier than the earliest allowed date
+	ErrStartDateTooFarInPast APIErrorCode = 4000012
+	// ErrStartDateAfterEndDate indicates that the end date precedes the start date, or the two dates are equal
+	ErrStartDateAfterEndDate APIErrorCode = 4000013
+	// ErrInvalidPaginationToken indicates the pagination token is invalid
+	ErrInvalidPaginationToken APIErrorCode = 4000014
+	// ErrInvalidStartDate indicates the start date is invalid
+	ErrInvalidStartDate APIErrorCode = 4000015
+	// ErrInvalidEndDate indicates the end date is invalid
+	ErrInvalidEndDate APIErrorCode = 4000016
+	// ErrPaginationTokenExpired indicates the pagination token expired
+	ErrPaginationTokenExpired APIErrorCode = 4000017
+	// ErrInvalidNotificationType indicates the notification type or subtype is invalid
+	ErrInvalidNotificationType APIErrorCode = 4000018
+	// ErrMultipleFiltersSupplied indicates the request is invalid because it has too many constraints applied
+	ErrMultipleFiltersSupplied APIErrorCode = 4000019
+	// ErrInvalidTestNotificationToken indicates the test notification token is invalid
+	ErrInvalidTestNotificationToken APIErrorCode = 4000020
+	// ErrInvalidSort indicates an invalid sort parameter
+	ErrInvalidSort APIErrorCode = 4000021
+	// ErrInvalidProductType indicates an invalid product type parameter
+	ErrInvalidProductType APIErrorCode = 4000022
+	// ErrInvalidProductID indicates the product ID parameter is invalid
+	ErrInvalidProductID APIErrorCode = 4000023
+	// ErrInvalidSubscriptionGroupIdentifier indicates an invalid subscription group identifier
+	ErrInvalidSubscriptionGroupIdentifier APIErrorCode = 4000024
+	// ErrInvalidExcludeRevoked indicates the query parameter exclude-revoked is invalid
+	ErrInvalidExcludeRevoked APIErrorCode = 4000025
+	// ErrInvalidInAppOwnershipType indicates an invalid in-app ownership type parameter
+	ErrInvalidInAppOwnershipType APIErrorCode = 4000026
+	// ErrInvalidEmptyStorefrontCountryCodeList indicates a required storefront country code is empty
+	ErrInvalidEmptyStorefrontCountryCodeList APIErrorCode = 4000027
+	// ErrInvalidStorefrontCountryCode indicates a storefront code is invalid
+	ErrInvalidStorefrontCountryCode APIErrorCode = 4000028
+	// ErrInvalidRevoked indicates the revoked parameter contains an invalid value
+	ErrInvalidRevoked APIErrorCode = 4000030
+	// ErrInvalidStatus indicates the status parameter is invalid
+	ErrInvalidStatus APIErrorCode = 4000031
+	// ErrInvalidAccountTenure indicates the value of the account tenure field is invalid
+	ErrInvalidAccountTenure APIErrorCode = 4000032
+	// ErrInvalidAppAccountToken indicates the value of the app account token field is invalid
+	ErrInvalidAppAccountToken APIErrorCode = 4000033
+	// ErrInvalidConsumptionStatus indicates the value of the consumption status field is invalid
+	ErrInvalidConsumptionStatus APIErrorCode = 4000034
+	// ErrInvalidCustomerConsented indicates the customer consented field is invalid or doesn't indicate that the customer consented
+	ErrInvalidCustomerConsented APIErrorCode = 4000035
+	// ErrInvalidDeliveryStatus indicates the value in the delivery status field is invalid
+	ErrInvalidDeliveryStatus APIErrorCode = 4000036
+	// ErrInvalidLifetimeDollarsPurchased indicates the value in the lifetime dollars purchased field is invalid
+	ErrInvalidLifetimeDollarsPurchased APIErrorCode = 4000037
+	// ErrInvalidLifetimeDollarsRefunded indicates the value in the lifetime dollars refunded field is invalid
+	ErrInvalidLifetimeDollarsRefunded APIErrorCode = 4000038
+	// ErrInvalidPlatform indicates the value in the platform field is invalid
+	ErrInvalidPlatform APIErrorCode = 4000039
+	// ErrInvalidPlayTime indicates the value in the playtime field is invalid
+	ErrInvalidPlayTime APIErrorCode = 4000040
+	// ErrInvalidSampleContentProvided indicates the value in the sample content provided field is invalid
+	ErrInvalidSampleContentProvided APIErrorCode = 4000041
+	// ErrInvalidUserStatus indicates the value in the user status field is invalid
+	ErrInvalidUserStatus APIErrorCode = 4000042
+	// ErrInvalidTransactionNotConsumable indicates the transaction identifier doesn't represent a consumable in-app purchase
+	ErrInvalidTransactionNotConsumable APIErrorCode = 4000043
+	// ErrInvalidTransactionTypeNotSupported indicates the transaction identifier represents an unsupported in-app purchase type
+	ErrInvalidTransactionTypeNotSupported APIErrorCode = 4000047
+	// ErrAppTransactionIDNotSupported indicates the endpoint doesn't support an app transaction ID
+	ErrAppTransactionIDNotSupported APIErrorCode = 4000048
+	// ErrInvalidAppAccountTokenUUID indicates the app account token value is not a valid UUID
+	ErrInvalidAppAccountTokenUUID APIErrorCode = 4000183
+	// ErrFamilyTransactionNotSupported indicates the transaction is for a product the customer obtains through Family Sharing, which the endpoint doesn't support
+	ErrFamilyTransactionNotSupported APIErrorCode = 4000185
+	// ErrTransactionIDIsNotOriginalTransactionID indicates the endpoint expects an original transaction identifier
+	ErrTransactionIDIsNotOriginalTransactionID APIErrorCode = 4000187
+	// ErrSubscriptionExtensionIneligible indicates the subscription doesn't qualify for a renewal-date extension due to its subscription state
+	ErrSubscriptionExtensionIneligible APIErrorCode = 4030004
+	// ErrSubscriptionMaxExtension indicates the subscription doesn't qualify for a renewal-date extension because it has already received the maximum extensions
+	ErrSubscriptionMaxExtension APIErrorCode = 4030005
+	// ErrFamilySharedSubscriptionExtensionIneligible indicates a subscription isn't directly eligible for a renewal date extension because the user obtained it through Family Sharing
+	ErrFamilySharedSubscriptionExtensionIneligible APIErrorCode = 4030007
+	// ErrAccountNotFound indicates the App Store account wasn't found
+	ErrAccountNotFound APIErrorCode = 4040001
+	// ErrAccountNotFoundRetryable indicates the App Store account wasn't found, but you can try again
+	ErrAccountNotFoundRetryable APIErrorCode = 4040002
+	// ErrAppNotFound indicates the app wasn't found
+	ErrAppNotFound APIErrorCode = 4040003
+	// ErrAppNotFoundRetryable indicates the app wasn't found, but you can try again
+	ErrAppNotFoundRetryable APIErrorCode = 4040004
+	// ErrOriginalTransactionIDNotFound indicates an original transaction identifier wasn't found
+	ErrOriginalTransactionIDNotFound APIErrorCode = 4040005
+	// ErrOriginalTransactionIDNotFoundRetryable indicates the original transaction identifier wasn't found, but you can try again
+	ErrOriginalTransactionIDNotFoundRetryable APIErrorCode = 4040006
+	// ErrServerNotificationURLNotFound indicates that the App Store server couldn't find a notifications URL for your app in this environment
+	ErrServerNotificationURLNotFound APIErrorCode = 4040007
+	// ErrTestNotificationNotFound indicates that the test notification token is expired or the test notification status isn't available
+	ErrTestNotificationNotFound APIErrorCode = 4040008
+	// ErrStatusRequestNotFound indicates the server didn't find a subscription-renewal-date extension request for the request identifier and product identifier you provided
+	ErrStatusRequestNotFound APIErrorCode = 4040009
+	// ErrTransactionIDNotFound indicates a transaction identifier wasn't found
+	ErrTransactionIDNotFound APIErrorCode = 4040010
+	// ErrRateLimitExceeded indicates that the request exceeded the rate limit
+	ErrRateLimitExceeded APIErrorCode = 4290000
+	// ErrGeneralInternal indicates a general internal error
+	ErrGeneralInternal APIErrorCode = 5000000
+	// ErrGeneralInternalRetryable indicates an unknown error occurred, but you can try again
+	ErrGeneralInternalRetryable APIErrorCode = 5000001
+)
+
+var apiErrorCodeNames = map[APIErrorCode]string{
+	ErrGeneralBadRequest:                           "GeneralBadRequest",
+	ErrInvalidAppIdentifier:                        "InvalidAppIdentifier",
+	ErrInvalidRequestRevision:                      "InvalidRequestRevision",
+	ErrInvalidTransactionID:                        "InvalidTransactionID",
+	ErrInvalidOriginalTransactionID:                "InvalidOriginalTransactionID",
+	ErrInvalidExtendByDays:                         "InvalidExtendByDays",
+	ErrInvalidExtendReasonCode:                     "InvalidExtendReasonCode",
+	ErrInvalidRequestIdentifier:                    "InvalidRequestIdentifier",
+	ErrStartDateTooFarInPast:                       "StartDateTooFarInPast",
+	ErrStartDateAfterEndDate:                       "StartDateAfterEndDate",
+	ErrInvalidPaginationToken:                      "InvalidPaginationToken",
+	ErrInvalidStartDate:                            "InvalidStartDate",
+	ErrInvalidEndDate:                              "InvalidEndDate",
+	ErrPaginationTokenExpired:                      "PaginationTokenExpired",
+	ErrInvalidNotificationType:                     "InvalidNotificationType",
+	ErrMultipleFiltersSupplied:                     "MultipleFiltersSupplied",
+	ErrInvalidTestNotificationToken:                "InvalidTestNotificationToken",
+	ErrInvalidSort:                                 "InvalidSort",
+	ErrInvalidProductType:                          "InvalidProductType",
+	ErrInvalidProductID:                            "InvalidProductID",
+	ErrInvalidSubscriptionGroupIdentifier:          "InvalidSubscriptionGroupIdentifier",
+	ErrInvalidExcludeRevoked:                       "InvalidExcludeRevoked",
+	ErrInvalidInAppOwnershipType:                   "InvalidInAppOwnershipType",
+	ErrInvalidEmptyStorefrontCountryCodeList:       "InvalidEmptyStorefrontCountryCodeList",
+	ErrInvalidStorefrontCountryCode:                "InvalidStorefrontCountryCode",
+	ErrInvalidRevoked:                              "InvalidRevoked",
+	ErrInvalidStatus:                               "InvalidStatus",
+	ErrInvalidAccountTenure:                        "InvalidAccountTenure",
+	ErrInvalidAppAccountToken:                      "InvalidAppAccountToken",
+	ErrInvalidConsumptionStatus:                    "InvalidConsumptionStatus",
+	ErrInvalidCustomerConsented:                    "InvalidCustomerConsented",
+	ErrInvalidDeliveryStatus:                       "InvalidDeliveryStatus",
+	ErrInvalidLifetimeDollarsPurchased:             "InvalidLifetimeDollarsPurchased",
+	ErrInvalidLifetimeDollarsRefunded:              "InvalidLifetimeDollarsRefunded",
+	ErrInvalidPlatform:                             "InvalidPlatform",
+	ErrInvalidPlayTime:                             "InvalidPlayTime",
+	ErrInvalidSampleContentProvided:                "InvalidSampleContentProvided",
+	ErrInvalidUserStatus:                           "InvalidUserStatus",
+	ErrInvalidTransactionNotConsumable:             "InvalidTransactionNotConsumable",
+	ErrInvalidTransactionTypeNotSupported:          "InvalidTransactionTypeNotSupported",
+	ErrAppTransactionIDNotSupported:                "AppTransactionIDNotSupported",
+	ErrInvalidAppAccountTokenUUID:                  "InvalidAppAccountTokenUUID",
+	ErrFamilyTransactionNotSupported:               "FamilyTransactionNotSupported",
+	ErrTransactionIDIsNotOriginalTransactionID:     "TransactionIDIsNotOriginalTransactionID",
+	ErrSubscriptionExtensionIneligible:             "SubscriptionExtensionIneligible",
+	ErrSubscriptionMaxExtension:                    "SubscriptionMaxExtension",
+	ErrFamilySharedSubscriptionExtensionIneligible: "FamilySharedSubscriptionExtensionIneligible",
+	ErrAccountNotFound:                             "AccountNotFound",
+	ErrAccountNotFoundRetryable:                    "AccountNotFoundRetryable",
+	ErrAppNotFound:                                 "AppNotFound",
+	ErrAppNotFoundRetryable:                        "AppNotFoundRetryable",
+	ErrOriginalTransactionIDNotFound:               "OriginalTransactionIDNotFound",
+	ErrOriginalTransactionIDNotFoundRetryable:      "OriginalTransactionIDNotFoundRetryable",
+	ErrServerNotificationURLNotFound:               "ServerNotificationURLNotFound",
+	ErrTestNotificationNotFound:                    "TestNotificationNotFound",
+	ErrStatusRequestNotFound:                       "StatusRequestNotFound",
+	ErrTransactionIDNotFound:                       "TransactionIDNotFound",
+	ErrRateLimitExceeded:                           "RateLimitExceeded",
+	ErrGeneralInternal:                             "GeneralInternal",
+	ErrGeneralInternalRetryable:                    "GeneralInternalRetryable",
+}
+
+// String returns the name of the error code
+func (c APIErrorCode) String() string {
+	if name, ok := apiErrorCodeNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("APIErrorCode(%d)", int(c))
+}
+
+// Error implements the error interface
+func (c APIErrorCode) Error() string {
+	return fmt.Sprintf("App Store Server API error: %d - %s", int(c), c.String())
+}
+
+// IsRetryable returns true if Apple documents the error as one you can try again
+func (c APIErrorCode) IsRetryable() bool {
+	switch c {
+	case ErrAccountNotFoundRetryable, ErrAppNotFoundRetryable, ErrOriginalTransactionIDNotFoundRetryable,
+		ErrRateLimitExceeded, ErrGeneralInternalRetryable:
+		return true
+	default:
+		return false
+	}
+}
+
 // APIError represents an error returned by the App Store Server API
 type APIError struct {
 	ErrorCode    int    `json:"errorCode"`
 	ErrorMessage string `json:"errorMessage"`
 	HTTPStatus   int    `json:"-"`
+	// RetryAfter is the delay requested by the Retry-After response header, zero if absent
+	RetryAfter time.Duration `json:"-"`
 }
 
 // Error implements the error interface
@@ -18,10 +236,40 @@ func (e *APIError) Error() string {
 	return fmt.Sprintf("App Store Server API error: %d - %s (HTTP %d)", e.ErrorCode, e.ErrorMessage, e.HTTPStatus)
 }
 
+// Code returns the ErrorCode as an APIErrorCode
+func (e *APIError) Code() APIErrorCode {
+	return APIErrorCode(e.ErrorCode)
+}
+
+// Is reports whether the error carries the target APIErrorCode, so that
+// errors.Is(err, ErrTransactionIDNotFound) matches
+func (e *APIError) Is(target error) bool {
+	code, ok := target.(APIErrorCode)
+	return ok && e.Code() == code
+}
+
+// IsRetryable returns true if the request may succeed when retried
+func (e *APIError) IsRetryable() bool {
+	return e.Code().IsRetryable() || shouldRetryStatus(e.HTTPStatus)
+}
+
+// IsNotFound returns true if the requested resource was not found
+func (e *APIError) IsNotFound() bool {
+	return e.HTTPStatus == http.StatusNotFound || (e.ErrorCode >= 4040000 && e.ErrorCode < 4050000)
+}
+
+// IsRateLimited returns true if the request exceeded the rate limit
+func (e *APIError) IsRateLimited() bool {
+	return e.HTTPStatus == http.StatusTooManyRequests || e.Code() == ErrRateLimitExceeded
+}
+
 // NewAPIErrorFromResponse creates an APIError from an HTTP response
 func NewAPIErrorFromResponse(resp *http.Response, body []byte) *APIError {
 	var apiErr APIError
 	apiErr.HTTPStatus = resp.StatusCode
+	if retryAfter, ok := parseRetryAfter(resp.Header); ok {
+		apiErr.RetryAfter = retryAfter
+	}
 
 	if len(body) > 0 {
 		if err := json.Unmarshal(body, &apiErr); err != nil {
@@ -53,6 +301,24 @@ func (e *VerificationError) Unwrap() error {
 	return e.Err
 }
 
+// DecodeError is a signed transaction of a response that failed verification with a lenient DecodePolicy
+type DecodeError struct {
+	// Index is the index of the transaction in SignedTransactions
+	Index      int
+	SignedData string
+	Err        error
+}
+
+// Error implements the error interface
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("signed transaction %d failed to verify and decode: %v", e.Index, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
 // NewVerificationError creates a new verification error
 func NewVerificationError(status VerificationStatus, err error) *VerificationError {
 	return &VerificationError{
@@ -0,0 +1,98 @@
+package appstoreserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestAPIErrorIs(t *testing.T) {
+	client, err := mockClientWithBody("models/transactionIdNotOriginalTransactionId.json", http.StatusBadRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := UpdateAppAccountTokenRequest{
+		OriginalTransactionID: "1234",
+		AppAccountToken:       "uuid",
+	}
+
+	err = client.SetAppAccountToken(context.Background(), &req)
+	wrapped := fmt.Errorf("set app account token: %w", err)
+	if !errors.Is(wrapped, ErrTransactionIDIsNotOriginalTransactionID) {
+		t.Fatalf("expected %v, got %v", ErrTransactionIDIsNotOriginalTransactionID, err)
+	}
+	if errors.Is(wrapped, ErrTransactionIDNotFound) {
+		t.Fatalf("expected %v not to match %v", err, ErrTransactionIDNotFound)
+	}
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("expected error to be of type *APIError but got %T", err)
+	}
+	if apiErr.IsRetryable() || apiErr.IsNotFound() || apiErr.IsRateLimited() {
+		t.Fatalf("expected a permanent client error, got %v", apiErr)
+	}
+}
+
+func TestAPIErrorRateLimited(t *testing.T) {
+	client, err := mockClientWithHandler(func(req *http.Request) (*http.Response, error) {
+		return mockResponse(http.StatusTooManyRequests, http.Header{"Retry-After": []string{"7"}}, "models/apiTooManyRequestsException.json")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.GetTransactionInfo(context.Background(), "1234")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("expected error to be of type *APIError but got %T", err)
+	}
+	if !errors.Is(err, ErrRateLimitExceeded) {
+		t.Fatalf("expected %v, got %v", ErrRateLimitExceeded, err)
+	}
+	if !apiErr.IsRateLimited() || !apiErr.IsRetryable() {
+		t.Fatalf("expected a retryable rate limit error, got %v", apiErr)
+	}
+	if apiErr.RetryAfter != 7*time.Second {
+		t.Fatalf("expected %v, got %v", 7*time.Second, apiErr.RetryAfter)
+	}
+}
+
+func TestAPIErrorClassification(t *testing.T) {
+	tests := []struct {
+		err         APIError
+		retryable   bool
+		notFound    bool
+		rateLimited bool
+	}{
+		{APIError{ErrorCode: int(ErrTransactionIDNotFound), HTTPStatus: http.StatusNotFound}, false, true, false},
+		{APIError{ErrorCode: int(ErrOriginalTransactionIDNotFoundRetryable), HTTPStatus: http.StatusNotFound}, true, true, false},
+		{APIError{ErrorCode: int(ErrGeneralInternal), HTTPStatus: http.StatusInternalServerError}, true, false, false},
+		{APIError{ErrorCode: int(ErrGeneralInternalRetryable), HTTPStatus: http.StatusInternalServerError}, true, false, false},
+		{APIError{ErrorCode: int(ErrInvalidTransactionID), HTTPStatus: http.StatusBadRequest}, false, false, false},
+		{APIError{ErrorCode: int(ErrRateLimitExceeded), HTTPStatus: http.StatusTooManyRequests}, true, false, true},
+	}
+	for _, tt := range tests {
+		if got := tt.err.IsRetryable(); got != tt.retryable {
+			t.Fatalf("%v: expected IsRetryable %v, got %v", tt.err.Code(), tt.retryable, got)
+		}
+		if got := tt.err.IsNotFound(); got != tt.notFound {
+			t.Fatalf("%v: expected IsNotFound %v, got %v", tt.err.Code(), tt.notFound, got)
+		}
+		if got := tt.err.IsRateLimited(); got != tt.rateLimited {
+			t.Fatalf("%v: expected IsRateLimited %v, got %v", tt.err.Code(), tt.rateLimited, got)
+		}
+	}
+}
+
+func TestAPIErrorCodeString(t *testing.T) {
+	if got := ErrTransactionIDNotFound.String(); got != "TransactionIDNotFound" {
+		t.Fatalf("expected %q, got %q", "TransactionIDNotFound", got)
+	}
+	if got := APIErrorCode(9990000).String(); got != "APIErrorCode(9990000)" {
+		t.Fatalf("expected %q, got %q", "APIErrorCode(9990000)", got)
+	}
+}
@@ -0,0 +1,13 @@
+package appstoreserver
+
+import "time"
+
+// SetNow sets the clock used for the expiry of cached OCSP responses
+func (c *CachingOCSPRevocationChecker) SetNow(now func() time.Time) {
+	c.now = now
+}
+
+// SetNow sets the clock used for the staleness of loaded CRLs
+func (c *CRLRevocationChecker) SetNow(now func() time.Time) {
+	c.now = now
+}
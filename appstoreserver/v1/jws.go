@@ -1,96 +1,163 @@
 package appstoreserver
 
 import (
-	"bytes"
+	"context"
 	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
 	"crypto/x509"
-	"encoding/asn1"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"net/http"
-	"net/url"
+	"slices"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/gh73962/appleapis/appstoreservernotifications/v2"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/maypok86/otter/v2"
-	"golang.org/x/crypto/ocsp"
 )
 
 const (
-	// MaximumCacheSize limits the number of cached certificates
+	// MaximumCacheSize is the default number of cached certificate chains
 	MaximumCacheSize = 32
-	// CacheTimeLimit defines how long certificates are cached (15 minutes)
+	// CacheTimeLimit is the default time certificate chains are cached (15 minutes)
 	CacheTimeLimit = 15 * time.Minute
 )
 
+// ChainCacheStats reports the usage of the verified certificate chain cache
+type ChainCacheStats struct {
+	Hits   uint64
+	Misses uint64
+	// Size is the approximate number of cached chains
+	Size int
+}
+
 // chainVerifier handles certificate chain verification
 type chainVerifier struct {
-	rootCertificates   [][]byte
-	cache              *otter.Cache[string, *ecdsa.PublicKey]
-	enableStrictChecks bool
+	rootCertificates [][]byte
+	// roots are the parsed rootCertificates chains must end in
+	roots *x509.CertPool
+	// skipRootPinning trusts the root certificate of the x5c header instead of roots
+	skipRootPinning   bool
+	cache             *otter.Cache[[sha256.Size]byte, *verifiedChain]
+	revocationChecker RevocationChecker
+	// httpClient is passed to revocationChecker for checkers without their own HTTP client
+	httpClient *http.Client
+	hits       atomic.Uint64
+	misses     atomic.Uint64
 }
 
-// generateCacheKey creates a unique cache key for a set of certificates
-func generateCacheKey(certificates []string) string {
-	if len(certificates) == 0 {
-		return ""
-	}
-	// Use all certificates to create a unique key like Python version
-	// which uses tuple(certificates) as key
-	key := ""
+// verifiedChain is the result of a successful chain verification
+type verifiedChain struct {
+	publicKey *ecdsa.PublicKey
+	// notBefore and notAfter bound the dates at which every certificate of the chain is valid
+	notBefore time.Time
+	notAfter  time.Time
+}
+
+// validAt reports whether every certificate of the chain is valid at effectiveDate
+func (v *verifiedChain) validAt(effectiveDate int64) bool {
+	t := time.Unix(effectiveDate, 0)
+	return !t.Before(v.notBefore) && !t.After(v.notAfter)
+}
+
+// generateCacheKey hashes the certificates of a chain
+func generateCacheKey(certificates []string) [sha256.Size]byte {
+	h := sha256.New()
 	for _, cert := range certificates {
-		key += cert + "|"
+		h.Write([]byte(cert))
+		// The separator is not part of the base64 alphabet
+		h.Write([]byte{'|'})
 	}
+	var key [sha256.Size]byte
+	h.Sum(key[:0])
 	return key
 }
 
-// newChainVerifier creates a new chain verifier
-func newChainVerifier(rootCertificates [][]byte) *chainVerifier {
-	options := &otter.Options[string, *ecdsa.PublicKey]{
-		MaximumSize:      MaximumCacheSize,
-		ExpiryCalculator: otter.ExpiryWriting[string, *ecdsa.PublicKey](CacheTimeLimit),
+// newChainVerifier creates a new chain verifier, revocationChecker may be nil to skip revocation checks.
+// Up to cacheSize verified chains are cached for cacheTTL, the defaults are used if they are zero
+// and caching is disabled if cacheSize is negative.
+func newChainVerifier(rootCertificates [][]byte, revocationChecker RevocationChecker, cacheSize int, cacheTTL time.Duration) *chainVerifier {
+	c := chainVerifier{
+		rootCertificates:  rootCertificates,
+		roots:             x509.NewCertPool(),
+		revocationChecker: revocationChecker,
+	}
+	for _, root := range rootCertificates {
+		// Unparsable roots are ignored, verification fails if none is left
+		if cert, err := x509.ParseCertificate(root); err == nil {
+			c.roots.AddCert(cert)
+		}
+	}
+	if cacheSize < 0 {
+		return &c
+	}
+	if cacheSize == 0 {
+		cacheSize = MaximumCacheSize
+	}
+	if cacheTTL <= 0 {
+		cacheTTL = CacheTimeLimit
+	}
+
+	options := &otter.Options[[sha256.Size]byte, *verifiedChain]{
+		MaximumSize:      cacheSize,
+		ExpiryCalculator: otter.ExpiryWriting[[sha256.Size]byte, *verifiedChain](cacheTTL),
 	}
 
 	cache, err := otter.New(options)
 	if err != nil {
 		panic(fmt.Sprintf("failed to create certificate cache: %v", err))
 	}
-
-	return &chainVerifier{
-		rootCertificates: rootCertificates,
-		cache:            cache,
-	}
+	c.cache = cache
+	return &c
 }
 
 // verifyChain verifies the certificate chain and returns the public key for signature verification
-func (c *chainVerifier) verifyChain(certificates []string, enableOnlineChecks bool, effectiveDate int64) (*ecdsa.PublicKey, error) {
-	if enableOnlineChecks && len(certificates) > 0 {
-		cacheKey := generateCacheKey(certificates)
-		if cachedKey, found := c.cache.GetIfPresent(cacheKey); found {
-			return cachedKey, nil
+func (c *chainVerifier) verifyChain(certificates []string, effectiveDate int64) (*ecdsa.PublicKey, error) {
+	if c.cache == nil || len(certificates) == 0 {
+		chain, err := c.verifyChainWithoutCaching(certificates, effectiveDate)
+		if err != nil {
+			return nil, err
 		}
+		return chain.publicKey, nil
+	}
+
+	cacheKey := generateCacheKey(certificates)
+	// A cached chain is only used within its validity, offline checks verify at the signed date
+	if chain, found := c.cache.GetIfPresent(cacheKey); found && chain.validAt(effectiveDate) {
+		c.hits.Add(1)
+		return chain.publicKey, nil
 	}
+	c.misses.Add(1)
 
-	publicKey, err := c.verifyChainWithoutCaching(certificates, enableOnlineChecks, effectiveDate)
+	chain, err := c.verifyChainWithoutCaching(certificates, effectiveDate)
 	if err != nil {
 		return nil, err
 	}
+	c.cache.Set(cacheKey, chain)
 
-	if enableOnlineChecks && len(certificates) > 0 {
-		cacheKey := generateCacheKey(certificates)
-		c.cache.Set(cacheKey, publicKey)
-	}
+	return chain.publicKey, nil
+}
 
-	return publicKey, nil
+// stats returns the usage of the chain cache
+func (c *chainVerifier) stats() ChainCacheStats {
+	stats := ChainCacheStats{
+		Hits:   c.hits.Load(),
+		Misses: c.misses.Load(),
+	}
+	if c.cache != nil {
+		stats.Size = c.cache.EstimatedSize()
+	}
+	return stats
 }
 
 // verifyChainWithoutCaching performs the actual certificate chain verification without caching
-func (c *chainVerifier) verifyChainWithoutCaching(certificates []string, enableOnlineChecks bool, effectiveDate int64) (*ecdsa.PublicKey, error) {
+func (c *chainVerifier) verifyChainWithoutCaching(certificates []string, effectiveDate int64) (*verifiedChain, error) {
 	if len(c.rootCertificates) == 0 {
 		return nil, NewVerificationError(VerificationStatusInvalidCertificate, errors.New("no root certificates provided"))
 	}
@@ -129,28 +196,12 @@ func (c *chainVerifier) verifyChainWithoutCaching(certificates []string, enableO
 		return nil, NewVerificationError(VerificationStatusInvalidCertificate, fmt.Errorf("failed to parse root certificate: %w", err))
 	}
 
-	if c.enableStrictChecks {
-		var trusted bool
-		for _, trustedRoot := range c.rootCertificates {
-			trustedRootCert, err := x509.ParseCertificate(trustedRoot)
-			if err != nil {
-				continue
-			}
-
-			if rootCert.Equal(trustedRootCert) {
-				trusted = true
-				break
-			}
-		}
-
-		if !trusted {
-			return nil, NewVerificationError(VerificationStatusInvalidCertificate, errors.New("root certificate is not trusted"))
-		}
+	roots := c.roots
+	if c.skipRootPinning {
+		roots = x509.NewCertPool()
+		roots.AddCert(rootCert)
 	}
 
-	roots := x509.NewCertPool()
-	roots.AddCert(rootCert)
-
 	intermediates := x509.NewCertPool()
 	intermediates.AddCert(intermediateCert)
 
@@ -160,21 +211,29 @@ func (c *chainVerifier) verifyChainWithoutCaching(certificates []string, enableO
 		CurrentTime:   time.Unix(effectiveDate, 0),
 	}
 
-	_, err = leafCert.Verify(opts)
+	chains, err := leafCert.Verify(opts)
 	if err != nil {
 		return nil, NewVerificationError(VerificationStatusFailure, fmt.Errorf("certificate chain verification failed: %w", err))
 	}
+	// The trusted root the chain ends in is checked rather than the one of the x5c header
+	if path := chains[0]; len(path) != 3 || !path[1].Equal(intermediateCert) {
+		return nil, NewVerificationError(VerificationStatusInvalidChainLength, errors.New("certificate chain does not end in a trusted root through the intermediate certificate"))
+	}
+	rootCert = chains[0][2]
 
 	if err := c.checkAppleOIDs(leafCert, intermediateCert); err != nil {
 		return nil, err
 	}
 
-	if enableOnlineChecks {
-		if err := c.checkOCSPStatus(leafCert, intermediateCert, rootCert); err != nil {
-			return nil, err
+	if c.revocationChecker != nil {
+		ctx, cancel := context.WithTimeout(withHTTPClient(context.Background(), c.httpClient), RevocationCheckTimeout)
+		defer cancel()
+
+		if err := c.revocationChecker.CheckRevocation(ctx, leafCert, intermediateCert); err != nil {
+			return nil, NewVerificationError(VerificationStatusFailure, err)
 		}
-		if err := c.checkOCSPStatus(intermediateCert, rootCert, rootCert); err != nil {
-			return nil, err
+		if err := c.revocationChecker.CheckRevocation(ctx, intermediateCert, rootCert); err != nil {
+			return nil, NewVerificationError(VerificationStatusFailure, err)
 		}
 	}
 
@@ -183,7 +242,21 @@ func (c *chainVerifier) verifyChainWithoutCaching(certificates []string, enableO
 		return nil, NewVerificationError(VerificationStatusInvalidCertificate, errors.New("leaf certificate does not contain ECDSA public key"))
 	}
 
-	return publicKey, nil
+	chain := verifiedChain{
+		publicKey: publicKey,
+		notBefore: leafCert.NotBefore,
+		notAfter:  leafCert.NotAfter,
+	}
+	for _, cert := range []*x509.Certificate{intermediateCert, rootCert} {
+		if cert.NotBefore.After(chain.notBefore) {
+			chain.notBefore = cert.NotBefore
+		}
+		if cert.NotAfter.Before(chain.notAfter) {
+			chain.notAfter = cert.NotAfter
+		}
+	}
+
+	return &chain, nil
 }
 
 // checkAppleOIDs verifies that the certificates contain the required Apple OIDs
@@ -211,98 +284,6 @@ func (c *chainVerifier) hasOID(cert *x509.Certificate, oidStr string) bool {
 	return false
 }
 
-// checkOCSPStatus performs OCSP (Online Certificate Status Protocol) checking
-func (c *chainVerifier) checkOCSPStatus(cert, issuer, root *x509.Certificate) error {
-	ocspRequest, err := ocsp.CreateRequest(cert, issuer, nil)
-	if err != nil {
-		return NewVerificationError(VerificationStatusFailure, fmt.Errorf("failed to create OCSP request: %w", err))
-	}
-
-	ocspServerURLs := c.getOCSPServerURLs(cert)
-	if len(ocspServerURLs) == 0 {
-		return NewVerificationError(VerificationStatusFailure, errors.New("no OCSP server URLs found in certificate"))
-	}
-
-	for _, serverURL := range ocspServerURLs {
-		response, err := c.queryOCSPServer(serverURL, ocspRequest)
-		if err != nil {
-			continue
-		}
-
-		ocspResponse, err := ocsp.ParseResponse(response, nil)
-		if err != nil {
-			continue
-		}
-
-		if ocspResponse.Status == ocsp.Good {
-			// Additional verification like Python version
-			// Re-parse with issuer for proper signature verification
-			ocspResponseVerified, err := ocsp.ParseResponse(response, issuer)
-			if err != nil {
-				continue
-			}
-			if ocspResponseVerified.Status == ocsp.Good {
-				return nil
-			}
-		}
-
-		return NewVerificationError(VerificationStatusFailure, fmt.Errorf("certificate status is not good: %d", ocspResponse.Status))
-	}
-
-	return NewVerificationError(VerificationStatusFailure, errors.New("failed to verify certificate status via OCSP"))
-}
-
-// getOCSPServerURLs extracts OCSP server URLs from certificate's AIA extension
-func (c *chainVerifier) getOCSPServerURLs(cert *x509.Certificate) []string {
-	var ocspURLs []string
-
-	for _, ext := range cert.Extensions {
-		if ext.Id.Equal(asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 1}) {
-			var aia []struct {
-				Method   asn1.ObjectIdentifier
-				Location asn1.RawValue
-			}
-
-			if _, err := asn1.Unmarshal(ext.Value, &aia); err == nil {
-				for _, access := range aia {
-					if access.Method.Equal(asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1}) {
-						if access.Location.Tag == 6 {
-							ocspURLs = append(ocspURLs, string(access.Location.Bytes))
-						}
-					}
-				}
-			}
-		}
-	}
-
-	return ocspURLs
-}
-
-// queryOCSPServer sends OCSP request to server and returns response
-func (c *chainVerifier) queryOCSPServer(serverURL string, request []byte) ([]byte, error) {
-	_, err := url.Parse(serverURL)
-	if err != nil {
-		return nil, fmt.Errorf("invalid OCSP server URL: %w", err)
-	}
-
-	resp, err := http.Post(serverURL, "application/ocsp-request", bytes.NewReader(request))
-	if err != nil {
-		return nil, fmt.Errorf("failed to send OCSP request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("OCSP server returned status: %d", resp.StatusCode)
-	}
-
-	responseBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read OCSP response: %w", err)
-	}
-
-	return responseBody, nil
-}
-
 // SignedDataVerifier provides utility methods for verifying and decoding App Store signed data
 type SignedDataVerifier struct {
 	rootCertificates   [][]byte
@@ -312,25 +293,59 @@ type SignedDataVerifier struct {
 	chainVerifier      *chainVerifier
 	enableOnlineChecks bool
 	enableAutoDecode   bool
+	decodePolicy       DecodePolicy
+	// acceptedEnvironments are accepted in addition to environment
+	acceptedEnvironments []Environment
 }
 
 // NewSignedDataVerifier creates a new SignedDataVerifier instance
 func NewSignedDataVerifier(config *ClientConfig) (*SignedDataVerifier, error) {
-	if config.Environment == EnvironmentProduction && config.AppAppleID == 0 {
+	if (config.Environment == EnvironmentProduction || slices.Contains(config.AcceptedEnvironments, EnvironmentProduction)) && config.AppAppleID == 0 {
 		return nil, errors.New("appAppleID is required when the environment is Production")
 	}
 
+	var acceptedEnvironments []Environment
+	for _, environment := range config.AcceptedEnvironments {
+		if environment != config.Environment && !slices.Contains(acceptedEnvironments, environment) {
+			acceptedEnvironments = append(acceptedEnvironments, environment)
+		}
+	}
+
+	chainVerifier := newChainVerifier(config.RootCertificates, config.revocationChecker(), config.ChainCacheSize, config.ChainCacheTTL)
+	chainVerifier.skipRootPinning = config.InsecureSkipRootPinning
+	chainVerifier.httpClient = config.HTTPClient
+
 	return &SignedDataVerifier{
-		rootCertificates:   config.RootCertificates,
-		environment:        config.Environment,
-		bundleID:           config.BundleID,
-		appAppleID:         config.AppAppleID,
-		chainVerifier:      newChainVerifier(config.RootCertificates),
-		enableOnlineChecks: config.EnableOnlineChecks,
-		enableAutoDecode:   config.EnableAutoDecode,
+		rootCertificates:     config.RootCertificates,
+		environment:          config.Environment,
+		bundleID:             config.BundleID,
+		appAppleID:           config.AppAppleID,
+		chainVerifier:        chainVerifier,
+		enableOnlineChecks:   config.EnableOnlineChecks,
+		enableAutoDecode:     config.EnableAutoDecode,
+		decodePolicy:         config.DecodePolicy,
+		acceptedEnvironments: acceptedEnvironments,
 	}, nil
 }
 
+// ChainCacheStats returns the hit and miss counts of the verified certificate chain cache
+func (v *SignedDataVerifier) ChainCacheStats() ChainCacheStats {
+	return v.chainVerifier.stats()
+}
+
+// acceptsEnvironment reports whether signed data issued in environment is accepted
+func (v *SignedDataVerifier) acceptsEnvironment(environment Environment) bool {
+	return environment == v.environment || slices.Contains(v.acceptedEnvironments, environment)
+}
+
+// requiresAppAppleID reports whether signed data issued in environment must carry the configured appAppleID
+func (v *SignedDataVerifier) requiresAppAppleID(environment Environment) bool {
+	if len(v.acceptedEnvironments) == 0 {
+		return v.environment == EnvironmentProduction
+	}
+	return environment == EnvironmentProduction
+}
+
 // VerifyAndDecodeRenewalInfo verifies and decodes a signedRenewalInfo obtained from the App Store Server API
 func (v *SignedDataVerifier) VerifyAndDecodeRenewalInfo(signedRenewalInfo string) (*JWSRenewalInfoDecodedPayload, error) {
 	decodedPayload, err := v.decodeSignedObject(signedRenewalInfo)
@@ -343,7 +358,7 @@ func (v *SignedDataVerifier) VerifyAndDecodeRenewalInfo(signedRenewalInfo string
 		return nil, fmt.Errorf("failed to unmarshal renewal info: %w", err)
 	}
 
-	if renewalInfo.Environment != v.environment {
+	if !v.acceptsEnvironment(renewalInfo.Environment) {
 		return nil, NewVerificationError(VerificationStatusInvalidEnvironment, nil)
 	}
 
@@ -366,7 +381,7 @@ func (v *SignedDataVerifier) VerifyAndDecodeSignedTransaction(signedTransaction
 		return nil, NewVerificationError(VerificationStatusInvalidAppIdentifier, nil)
 	}
 
-	if transactionInfo.Environment != v.environment {
+	if !v.acceptsEnvironment(transactionInfo.Environment) {
 		return nil, NewVerificationError(VerificationStatusInvalidEnvironment, nil)
 	}
 
@@ -411,17 +426,77 @@ func (v *SignedDataVerifier) VerifyAndDecodeNotification(signedPayload string) (
 		}
 	}
 
-	if bundleID != v.bundleID || (v.environment == EnvironmentProduction && appAppleID != v.appAppleID) {
+	if bundleID != v.bundleID || (v.requiresAppAppleID(Environment(environment)) && appAppleID != v.appAppleID) {
 		return nil, NewVerificationError(VerificationStatusInvalidAppIdentifier, nil)
 	}
 
-	if Environment(environment) != v.environment {
+	if !v.acceptsEnvironment(Environment(environment)) {
 		return nil, NewVerificationError(VerificationStatusInvalidEnvironment, fmt.Errorf("expected %q, got %q", v.environment, Environment(environment)))
 	}
 
 	return &notification, nil
 }
 
+// VerifyAndDecodeAppTransaction verifies and decodes a signedAppTransaction obtained from StoreKit 2
+// See https://developer.apple.com/documentation/storekit/apptransaction
+func (v *SignedDataVerifier) VerifyAndDecodeAppTransaction(signedAppTransaction string) (*JWSAppTransactionDecodedPayload, error) {
+	decodedPayload, err := v.decodeSignedObject(signedAppTransaction)
+	if err != nil {
+		return nil, err
+	}
+
+	var appTransaction JWSAppTransactionDecodedPayload
+	if err := json.Unmarshal(decodedPayload, &appTransaction); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal app transaction: %w", err)
+	}
+
+	if appTransaction.BundleID != v.bundleID || (v.requiresAppAppleID(appTransaction.ReceiptType) && appTransaction.AppAppleID != v.appAppleID) {
+		return nil, NewVerificationError(VerificationStatusInvalidAppIdentifier, nil)
+	}
+
+	if !v.acceptsEnvironment(appTransaction.ReceiptType) {
+		return nil, NewVerificationError(VerificationStatusInvalidEnvironment, fmt.Errorf("expected %q, got %q", v.environment, appTransaction.ReceiptType))
+	}
+
+	return &appTransaction, nil
+}
+
+// VerifyAndDecodeAppTransactionForDevice verifies and decodes a signedAppTransaction and checks
+// that it was issued for the device identified by identifierForVendor
+func (v *SignedDataVerifier) VerifyAndDecodeAppTransactionForDevice(signedAppTransaction, identifierForVendor string) (*JWSAppTransactionDecodedPayload, error) {
+	appTransaction, err := v.VerifyAndDecodeAppTransaction(signedAppTransaction)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := appTransaction.VerifyDevice(identifierForVendor); err != nil {
+		return nil, err
+	}
+
+	return appTransaction, nil
+}
+
+// VerifyDeviceVerification recomputes the SHA-384 hash of the deviceVerificationNonce followed by
+// the device's identifierForVendor and compares it with the base64 encoded deviceVerification value
+// See https://developer.apple.com/documentation/storekit/apptransaction/deviceverification
+func VerifyDeviceVerification(deviceVerification, deviceVerificationNonce, identifierForVendor string) error {
+	if deviceVerification == "" || deviceVerificationNonce == "" || identifierForVendor == "" {
+		return NewVerificationError(VerificationStatusInvalidDeviceVerification, errors.New("deviceVerification, deviceVerificationNonce and identifierForVendor are required"))
+	}
+
+	expected, err := base64.StdEncoding.DecodeString(deviceVerification)
+	if err != nil {
+		return NewVerificationError(VerificationStatusInvalidDeviceVerification, fmt.Errorf("failed to decode deviceVerification: %w", err))
+	}
+
+	computed := sha512.Sum384([]byte(strings.ToLower(deviceVerificationNonce) + strings.ToLower(identifierForVendor)))
+	if subtle.ConstantTimeCompare(expected, computed[:]) != 1 {
+		return NewVerificationError(VerificationStatusInvalidDeviceVerification, errors.New("device verification hash mismatch"))
+	}
+
+	return nil
+}
+
 // decodeSignedObject decodes and verifies a signed JWT object
 func (v *SignedDataVerifier) decodeSignedObject(signedObj string) ([]byte, error) {
 	token, _, err := new(jwt.Parser).ParseUnverified(signedObj, jwt.MapClaims{})
@@ -482,7 +557,7 @@ func (v *SignedDataVerifier) decodeSignedObject(signedObj string) ([]byte, error
 		}
 	}
 
-	signingKey, err := v.chainVerifier.verifyChain(certificates, v.enableOnlineChecks, effectiveDate)
+	signingKey, err := v.chainVerifier.verifyChain(certificates, effectiveDate)
 	if err != nil {
 		return nil, err
 	}
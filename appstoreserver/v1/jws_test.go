@@ -1,10 +1,14 @@
 package appstoreserver
 
 import (
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
 	"os"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/gh73962/appleapis/appstoreservernotifications/v2"
 )
@@ -131,6 +135,147 @@ func TestRenewalInfoDecoding(t *testing.T) {
 	}
 }
 
+func TestAppTransactionDecoding(t *testing.T) {
+	client, err := mockTestClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signedAppTransaction, err := mockSignedData("models/appTransaction.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decodedPayload, err := client.Verifier.VerifyAndDecodeAppTransaction(signedAppTransaction)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decodedPayload == nil {
+		t.Fatal("expected non-nil decodedPayload")
+	}
+
+	if decodedPayload.ReceiptType != EnvironmentLocalTesting {
+		t.Fatalf("expected %q, got %q", EnvironmentLocalTesting, decodedPayload.ReceiptType)
+	}
+	if decodedPayload.AppAppleID != 531412 {
+		t.Fatalf("expected %v, got %v", 531412, decodedPayload.AppAppleID)
+	}
+	if decodedPayload.BundleID != "com.example" {
+		t.Fatalf("expected %q, got %q", "com.example", decodedPayload.BundleID)
+	}
+	if decodedPayload.ApplicationVersion != "1.2.3" {
+		t.Fatalf("expected %q, got %q", "1.2.3", decodedPayload.ApplicationVersion)
+	}
+	if decodedPayload.VersionExternalIdentifier != 512 {
+		t.Fatalf("expected %v, got %v", 512, decodedPayload.VersionExternalIdentifier)
+	}
+	if decodedPayload.ReceiptCreationDate != 1698148900000 {
+		t.Fatalf("expected %v, got %v", 1698148900000, decodedPayload.ReceiptCreationDate)
+	}
+	if decodedPayload.OriginalPurchaseDate != 1698148800000 {
+		t.Fatalf("expected %v, got %v", 1698148800000, decodedPayload.OriginalPurchaseDate)
+	}
+	if decodedPayload.OriginalApplicationVersion != "1.1.2" {
+		t.Fatalf("expected %q, got %q", "1.1.2", decodedPayload.OriginalApplicationVersion)
+	}
+	if decodedPayload.DeviceVerification != "device_verification_value" {
+		t.Fatalf("expected %q, got %q", "device_verification_value", decodedPayload.DeviceVerification)
+	}
+	if decodedPayload.DeviceVerificationNonce != "48ccfa42-7431-4f22-9908-7e88983e105a" {
+		t.Fatalf("expected %q, got %q", "48ccfa42-7431-4f22-9908-7e88983e105a", decodedPayload.DeviceVerificationNonce)
+	}
+	if decodedPayload.PreorderDate != 1698148700000 {
+		t.Fatalf("expected %v, got %v", 1698148700000, decodedPayload.PreorderDate)
+	}
+	if decodedPayload.AppTransactionID != "71134" {
+		t.Fatalf("expected %q, got %q", "71134", decodedPayload.AppTransactionID)
+	}
+	if decodedPayload.OriginalPlatform != PurchasePlatformIOS {
+		t.Fatalf("expected %q, got %q", PurchasePlatformIOS, decodedPayload.OriginalPlatform)
+	}
+}
+
+func TestAppTransactionWrongBundleID(t *testing.T) {
+	client, err := mockTestClient(WithBundleID("com.examplex"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signedAppTransaction, err := mockSignedData("models/appTransaction.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.Verifier.VerifyAndDecodeAppTransaction(signedAppTransaction)
+	if err == nil {
+		t.Fatal("expected error but got nil")
+	}
+	if !strings.Contains(err.Error(), "INVALID_APP_IDENTIFIER") {
+		t.Fatalf("expected error to contain %q but got %q", "INVALID_APP_IDENTIFIER", err.Error())
+	}
+}
+
+func TestVerifyDeviceVerification(t *testing.T) {
+	nonce := "48CCFA42-7431-4F22-9908-7E88983E105A"
+	identifierForVendor := "E5A1F2C3-0D4B-4C6E-9A8F-1B2C3D4E5F60"
+	sum := sha512.Sum384([]byte(strings.ToLower(nonce) + strings.ToLower(identifierForVendor)))
+	deviceVerification := base64.StdEncoding.EncodeToString(sum[:])
+
+	tests := []struct {
+		name                string
+		deviceVerification  string
+		nonce               string
+		identifierForVendor string
+		wantErr             bool
+	}{
+		{"match", deviceVerification, nonce, identifierForVendor, false},
+		{"match lowercase", deviceVerification, strings.ToLower(nonce), strings.ToLower(identifierForVendor), false},
+		{"other device", deviceVerification, nonce, "00000000-0000-0000-0000-000000000000", true},
+		{"other nonce", deviceVerification, "00000000-0000-0000-0000-000000000000", identifierForVendor, true},
+		{"malformed verification", "not base64!", nonce, identifierForVendor, true},
+		{"missing identifier", deviceVerification, nonce, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifyDeviceVerification(tt.deviceVerification, tt.nonce, tt.identifierForVendor)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if err == nil {
+				return
+			}
+			var verificationErr *VerificationError
+			if !errors.As(err, &verificationErr) {
+				t.Fatalf("expected error to be of type *VerificationError but got %T", err)
+			}
+			if verificationErr.Status != VerificationStatusInvalidDeviceVerification {
+				t.Fatalf("expected %v, got %v", VerificationStatusInvalidDeviceVerification, verificationErr.Status)
+			}
+		})
+	}
+}
+
+func TestAppTransactionDecodingForDevice(t *testing.T) {
+	client, err := mockTestClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signedAppTransaction, err := mockSignedData("models/appTransaction.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// appTransaction.json carries a placeholder deviceVerification value
+	_, err = client.Verifier.VerifyAndDecodeAppTransactionForDevice(signedAppTransaction, "E5A1F2C3-0D4B-4C6E-9A8F-1B2C3D4E5F60")
+	if err == nil {
+		t.Fatal("expected error but got nil")
+	}
+	if !strings.Contains(err.Error(), "INVALID_DEVICE_VERIFICATION") {
+		t.Fatalf("expected error to contain %q but got %q", "INVALID_DEVICE_VERIFICATION", err.Error())
+	}
+}
+
 func TestNotificationDecoding(t *testing.T) {
 	client, err := mockTestClient()
 	if err != nil {
@@ -460,3 +605,23 @@ func TestMalformedJWTWithMalformedData(t *testing.T) {
 		t.Fatalf("Received expected error for invalid JWT: %v", err)
 	}
 }
+
+func TestChainCacheStats(t *testing.T) {
+	client, err := mockTestClient(WithEnvironment(EnvironmentSandbox), WithChainCache(8, time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testNotification, err := os.ReadFile("../../testdata/mock_signed_data/testNotification")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for range 2 {
+		if _, err := client.Verifier.VerifyAndDecodeNotification(string(testNotification)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if stats := client.Verifier.ChainCacheStats(); stats.Hits != 1 || stats.Misses != 1 {
+		t.Fatalf("expected %d hit and %d miss, got %+v", 1, 1, stats)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"crypto/x509"
 	"encoding/pem"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -44,22 +45,41 @@ func (c *Claims) GetSubject() (string, error) {
 }
 
 func NewClaims(iss, bid string) *Claims {
-	now := time.Now()
+	return newClaims(iss, bid, time.Now(), DefaultTokenLifetime)
+}
+
+func newClaims(iss, bid string, now time.Time, lifetime time.Duration) *Claims {
 	return &Claims{
 		Issuer:         iss,
 		IssuedAt:       now.Unix(),
-		ExpirationTime: now.Add(5 * time.Minute).Unix(),
+		ExpirationTime: now.Add(lifetime).Unix(),
 		Audience:       "appstoreconnect-v1",
 		BundleID:       bid,
 	}
 }
 
-// TokenGenerator generates JWT tokens for App Store Server API authentication
+const (
+	// DefaultTokenLifetime is the default lifetime of API bearer tokens
+	DefaultTokenLifetime = 5 * time.Minute
+	// MaxTokenLifetime is the maximum lifetime of API bearer tokens accepted by Apple
+	MaxTokenLifetime = 60 * time.Minute
+	// tokenRefreshMargin is how long before expiry a cached token is replaced
+	tokenRefreshMargin = time.Minute
+)
+
+// TokenGenerator generates JWT tokens for App Store Server API authentication.
+// Tokens are cached and shared between requests until shortly before they expire.
 type TokenGenerator struct {
 	signingKey *ecdsa.PrivateKey
 	keyID      string
 	issuerID   string
 	bundleID   string
+	lifetime   time.Duration
+	now        func() time.Time
+
+	mu        sync.Mutex
+	token     string
+	refreshAt time.Time
 }
 
 // NewTokenGenerator creates a new JWT token generator
@@ -68,17 +88,37 @@ func NewTokenGenerator(config *ClientConfig) (*TokenGenerator, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse private key: %w", err)
 	}
+
+	lifetime := config.TokenLifetime
+	if lifetime <= 0 {
+		lifetime = DefaultTokenLifetime
+	}
+	if lifetime > MaxTokenLifetime {
+		lifetime = MaxTokenLifetime
+	}
+
 	return &TokenGenerator{
 		signingKey: privateKey,
 		keyID:      config.KeyID,
 		issuerID:   config.IssuerID,
 		bundleID:   config.BundleID,
+		lifetime:   lifetime,
+		now:        time.Now,
 	}, nil
 }
 
-// GenerateToken creates a new JWT token for API authentication
+// GenerateToken returns a JWT token for API authentication, reusing the cached token
+// until it is about to expire
 func (t *TokenGenerator) GenerateToken() (string, error) {
-	claims := NewClaims(t.issuerID, t.bundleID)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	if t.token != "" && now.Before(t.refreshAt) {
+		return t.token, nil
+	}
+
+	claims := newClaims(t.issuerID, t.bundleID, now, t.lifetime)
 	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
 	token.Header["kid"] = t.keyID
 
@@ -87,9 +127,22 @@ func (t *TokenGenerator) GenerateToken() (string, error) {
 		return "", fmt.Errorf("failed to sign JWT token: %w", err)
 	}
 
+	t.token = tokenString
+	t.refreshAt = now.Add(t.lifetime - min(tokenRefreshMargin, t.lifetime/2))
+
 	return tokenString, nil
 }
 
+// InvalidateToken discards the cached token so the next GenerateToken signs a new one,
+// for example after the API rejected the token with HTTP 401
+func (t *TokenGenerator) InvalidateToken() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.token = ""
+	t.refreshAt = time.Time{}
+}
+
 // ParsePrivateKeyFromPEM parses an ECDSA private key from PEM format
 func ParsePrivateKeyFromPEM(pemData []byte) (*ecdsa.PrivateKey, error) {
 	block, _ := pem.Decode(pemData)
@@ -0,0 +1,141 @@
+package appstoreserver
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestGenerateTokenIsCached(t *testing.T) {
+	client, err := mockTestClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	generator := client.TokenGenerator
+
+	now := time.Unix(1698148900, 0)
+	generator.now = func() time.Time { return now }
+
+	first, err := generator.GenerateToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now = now.Add(DefaultTokenLifetime - tokenRefreshMargin - time.Second)
+	second, err := generator.GenerateToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second {
+		t.Fatal("expected cached token to be reused")
+	}
+
+	now = now.Add(time.Second)
+	third, err := generator.GenerateToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if third == second {
+		t.Fatal("expected token to be refreshed ahead of expiry")
+	}
+
+	generator.InvalidateToken()
+	fourth, err := generator.GenerateToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fourth == third {
+		t.Fatal("expected invalidated token to be replaced")
+	}
+}
+
+func TestTokenLifetime(t *testing.T) {
+	tests := []struct {
+		lifetime time.Duration
+		want     time.Duration
+	}{
+		{0, DefaultTokenLifetime},
+		{20 * time.Minute, 20 * time.Minute},
+		{2 * time.Hour, MaxTokenLifetime},
+	}
+
+	for _, tt := range tests {
+		client, err := mockTestClient(WithTokenLifetime(tt.lifetime))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		token, err := client.TokenGenerator.GenerateToken()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		claims := jwt.MapClaims{}
+		if _, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (any, error) {
+			return &client.TokenGenerator.signingKey.PublicKey, nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		iat, _ := claims.GetIssuedAt()
+		exp, _ := claims.GetExpirationTime()
+		if got := exp.Sub(iat.Time); got != tt.want {
+			t.Fatalf("lifetime %v: expected %v, got %v", tt.lifetime, tt.want, got)
+		}
+	}
+}
+
+func TestGenerateTokenConcurrent(t *testing.T) {
+	client, err := mockTestClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		wg     sync.WaitGroup
+		tokens = make([]string, 16)
+	)
+	for i := range tokens {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tokens[i], _ = client.TokenGenerator.GenerateToken()
+		}()
+	}
+	wg.Wait()
+
+	for _, token := range tokens {
+		if token == "" || token != tokens[0] {
+			t.Fatal("expected all goroutines to share the cached token")
+		}
+	}
+}
+
+func TestUnauthorizedRefreshesToken(t *testing.T) {
+	var authorizations []string
+	client, err := mockClientWithHandler(func(req *http.Request) (*http.Response, error) {
+		authorizations = append(authorizations, req.Header.Get("Authorization"))
+		if len(authorizations) == 1 {
+			return mockResponse(http.StatusUnauthorized, nil, "")
+		}
+		return mockResponse(http.StatusOK, nil, "models/transactionInfoResponse.json")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.GetTransactionInfo(context.Background(), "1234"); err != nil {
+		t.Fatal(err)
+	}
+	if len(authorizations) != 2 {
+		t.Fatalf("expected %d attempts, got %d", 2, len(authorizations))
+	}
+	if authorizations[0] == authorizations[1] || !strings.HasPrefix(authorizations[1], "Bearer ") {
+		t.Fatalf("expected a fresh bearer token, got %q", authorizations)
+	}
+}
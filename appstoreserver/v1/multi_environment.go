@@ -0,0 +1,123 @@
+package appstoreserver
+
+import (
+	"context"
+	"errors"
+	"slices"
+)
+
+// MultiEnvironmentClient calls the production App Store Server API first and retries in sandbox
+// when the transaction isn't found there, as Apple recommends for purchases made in TestFlight
+// or during App Review. Every call returns the environment that answered.
+type MultiEnvironmentClient struct {
+	Production *Client
+	Sandbox    *Client
+	// Verifier verifies signed data from both environments, e.g. notifications sent to a shared URL
+	Verifier *SignedDataVerifier
+}
+
+// NewMultiEnvironmentClient creates a production and a sandbox Client from the same options,
+// the environment option is overridden and AppAppleID is required
+func NewMultiEnvironmentClient(options ...Option) (*MultiEnvironmentClient, error) {
+	production, err := New(slices.Concat(options, []Option{WithEnvironment(EnvironmentProduction)})...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Reuse the root certificates so they are downloaded at most once
+	sandbox, err := New(slices.Concat(options, []Option{
+		WithEnvironment(EnvironmentSandbox),
+		WithRootCertificates(production.Verifier.rootCertificates),
+	})...)
+	if err != nil {
+		return nil, err
+	}
+
+	verifier := *production.Verifier
+	verifier.acceptedEnvironments = []Environment{EnvironmentSandbox}
+
+	return &MultiEnvironmentClient{
+		Production: production,
+		Sandbox:    sandbox,
+		Verifier:   &verifier,
+	}, nil
+}
+
+// Client returns the client of environment, or nil if it isn't Production or Sandbox
+func (m *MultiEnvironmentClient) Client(environment Environment) *Client {
+	switch environment {
+	case EnvironmentProduction:
+		return m.Production
+	case EnvironmentSandbox:
+		return m.Sandbox
+	default:
+		return nil
+	}
+}
+
+// shouldFallback reports whether a production error means the transaction may exist in sandbox
+func shouldFallback(err error) bool {
+	return errors.Is(err, ErrTransactionIDNotFound) || errors.Is(err, ErrOriginalTransactionIDNotFound)
+}
+
+// withFallback calls call with the production client and, if the transaction isn't found, with the sandbox client
+func withFallback[T any](m *MultiEnvironmentClient, call func(*Client) (T, error)) (T, Environment, error) {
+	response, err := call(m.Production)
+	if err == nil || !shouldFallback(err) {
+		return response, EnvironmentProduction, err
+	}
+
+	response, err = call(m.Sandbox)
+	return response, EnvironmentSandbox, err
+}
+
+// GetTransactionHistory gets a customer's in-app purchase transaction history
+func (m *MultiEnvironmentClient) GetTransactionHistory(ctx context.Context, req *TransactionHistoryRequest) (*HistoryResponse, Environment, error) {
+	return withFallback(m, func(c *Client) (*HistoryResponse, error) {
+		return c.GetTransactionHistory(ctx, req)
+	})
+}
+
+// GetTransactionInfo gets information about a single transaction
+func (m *MultiEnvironmentClient) GetTransactionInfo(ctx context.Context, transactionID string) (*TransactionInfoResponse, Environment, error) {
+	return withFallback(m, func(c *Client) (*TransactionInfoResponse, error) {
+		return c.GetTransactionInfo(ctx, transactionID)
+	})
+}
+
+// GetAllSubscriptionStatuses gets the statuses for all of a customer's auto-renewable subscriptions
+func (m *MultiEnvironmentClient) GetAllSubscriptionStatuses(ctx context.Context, transactionID string, status ...SubscriptionStatus) (*StatusResponse, Environment, error) {
+	return withFallback(m, func(c *Client) (*StatusResponse, error) {
+		return c.GetAllSubscriptionStatuses(ctx, transactionID, status...)
+	})
+}
+
+// GetRefundHistory gets a paginated list of all of a customer's refunded in-app purchases
+func (m *MultiEnvironmentClient) GetRefundHistory(ctx context.Context, transactionID, revision string) (*RefundHistoryResponse, Environment, error) {
+	return withFallback(m, func(c *Client) (*RefundHistoryResponse, error) {
+		return c.GetRefundHistory(ctx, transactionID, revision)
+	})
+}
+
+// SetAppAccountToken sets the app account token value for a purchase
+func (m *MultiEnvironmentClient) SetAppAccountToken(ctx context.Context, req *UpdateAppAccountTokenRequest) (Environment, error) {
+	_, environment, err := withFallback(m, func(c *Client) (struct{}, error) {
+		return struct{}{}, c.SetAppAccountToken(ctx, req)
+	})
+	return environment, err
+}
+
+// SendConsumptionInfo sends consumption information about a consumable in-app purchase
+func (m *MultiEnvironmentClient) SendConsumptionInfo(ctx context.Context, req *ConsumptionRequest) (Environment, error) {
+	_, environment, err := withFallback(m, func(c *Client) (struct{}, error) {
+		return struct{}{}, c.SendConsumptionInfo(ctx, req)
+	})
+	return environment, err
+}
+
+// ExtendSubscriptionRenewalDate extends the renewal date of a customer's active subscription
+func (m *MultiEnvironmentClient) ExtendSubscriptionRenewalDate(ctx context.Context, req *ExtendRenewalDateRequest) (*ExtendRenewalDateResponse, Environment, error) {
+	return withFallback(m, func(c *Client) (*ExtendRenewalDateResponse, error) {
+		return c.ExtendSubscriptionRenewalDate(ctx, req)
+	})
+}
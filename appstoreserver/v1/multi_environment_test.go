@@ -0,0 +1,145 @@
+package appstoreserver
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/gh73962/appleapis/appstoreservernotifications/v2"
+)
+
+func mockMultiEnvironmentClient(handler func(req *http.Request) (*http.Response, error)) (*MultiEnvironmentClient, error) {
+	pk, err := os.ReadFile("../../testdata/certs/testSigningKey.p8")
+	if err != nil {
+		return nil, err
+	}
+	cert, err := os.ReadFile("../../testdata/certs/testCA.der")
+	if err != nil {
+		return nil, err
+	}
+
+	return NewMultiEnvironmentClient(
+		WithAppAppleID(1234),
+		WithBundleID("com.example"),
+		WithKeyID("keyId"),
+		WithIssuerID("issuerId"),
+		WithPrivateKey(pk),
+		WithRootCertificates([][]byte{cert}),
+		WithHTTPClient(&http.Client{Transport: &mockTransport{RoundTripFunc: handler}}),
+	)
+}
+
+func TestMultiEnvironmentClientNoFallback(t *testing.T) {
+	var hosts []string
+	client, err := mockMultiEnvironmentClient(func(req *http.Request) (*http.Response, error) {
+		hosts = append(hosts, "https://"+req.URL.Host)
+		if "https://"+req.URL.Host == ProductionBaseURL {
+			return mockJSONResponse(http.StatusBadRequest, APIError{ErrorCode: int(ErrGeneralBadRequest)})
+		}
+		return mockResponse(http.StatusOK, nil, "models/transactionInfoResponse.json")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, environment, err := client.GetTransactionInfo(context.Background(), "1234")
+	if !errors.Is(err, ErrGeneralBadRequest) || environment != EnvironmentProduction {
+		t.Fatalf("expected production error, got %v in %v", err, environment)
+	}
+	if len(hosts) != 1 {
+		t.Fatalf("expected %d requests, got %d", 1, len(hosts))
+	}
+}
+
+func TestMultiEnvironmentClientTransactionNotFound(t *testing.T) {
+	for _, code := range []APIErrorCode{ErrTransactionIDNotFound, ErrOriginalTransactionIDNotFound} {
+		var hosts []string
+		client, err := mockMultiEnvironmentClient(func(req *http.Request) (*http.Response, error) {
+			hosts = append(hosts, "https://"+req.URL.Host)
+			if "https://"+req.URL.Host == ProductionBaseURL {
+				return mockJSONResponse(http.StatusNotFound, APIError{ErrorCode: int(code)})
+			}
+			return mockResponse(http.StatusOK, nil, "models/transactionInfoResponse.json")
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		response, environment, err := client.GetTransactionInfo(context.Background(), "1234")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if environment != EnvironmentSandbox {
+			t.Fatalf("expected %v, got %v", EnvironmentSandbox, environment)
+		}
+		if response.SignedTransactionInfo != "signed_transaction_info_value" {
+			t.Fatalf("expected %q, got %q", "signed_transaction_info_value", response.SignedTransactionInfo)
+		}
+		if len(hosts) != 2 || hosts[0] != ProductionBaseURL || hosts[1] != SandboxBaseURL {
+			t.Fatalf("expected production then sandbox, got %v", hosts)
+		}
+	}
+}
+
+func TestMultiEnvironmentClientSandboxError(t *testing.T) {
+	client, err := mockMultiEnvironmentClient(func(req *http.Request) (*http.Response, error) {
+		return mockJSONResponse(http.StatusNotFound, APIError{ErrorCode: int(ErrTransactionIDNotFound)})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	environment, err := client.SetAppAccountToken(context.Background(), &UpdateAppAccountTokenRequest{
+		OriginalTransactionID: "1234",
+		AppAccountToken:       "7389a31a-fb6d-4569-a2a6-db7d85d84813",
+	})
+	if !errors.Is(err, ErrTransactionIDNotFound) {
+		t.Fatalf("expected %v, got %v", ErrTransactionIDNotFound, err)
+	}
+	if environment != EnvironmentSandbox {
+		t.Fatalf("expected %v, got %v", EnvironmentSandbox, environment)
+	}
+}
+
+func TestMultiEnvironmentClientVerifier(t *testing.T) {
+	client, err := mockMultiEnvironmentClient(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testNotification, err := os.ReadFile("../../testdata/mock_signed_data/testNotification")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.Production.Verifier.VerifyAndDecodeNotification(string(testNotification)); err == nil {
+		t.Fatal("expected error but got nil")
+	}
+	decodedPayload, err := client.Verifier.VerifyAndDecodeNotification(string(testNotification))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decodedPayload.NotificationType != appstoreservernotifications.TypeTest {
+		t.Fatalf("expected %q, got %q", appstoreservernotifications.TypeTest, decodedPayload.NotificationType)
+	}
+}
+
+func TestAcceptedEnvironments(t *testing.T) {
+	testNotification, err := os.ReadFile("../../testdata/mock_signed_data/testNotification")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := mockTestClient(WithEnvironment(EnvironmentProduction), WithAppAppleID(1235), WithAcceptedEnvironments(EnvironmentSandbox))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Verifier.VerifyAndDecodeNotification(string(testNotification)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := mockTestClient(WithEnvironment(EnvironmentSandbox), WithAppAppleID(0), WithAcceptedEnvironments(EnvironmentProduction)); err == nil {
+		t.Fatal("expected error but got nil")
+	}
+}
@@ -0,0 +1,213 @@
+package appstoreserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gh73962/appleapis/appstoreservernotifications/v2"
+)
+
+// DefaultMaxNotificationBodySize limits the size of notification request bodies (1 MiB)
+const DefaultMaxNotificationBodySize int64 = 1 << 20
+
+// Notification is a verified App Store Server Notification together with its decoded
+// signedTransactionInfo and signedRenewalInfo, which are nil when absent
+type Notification struct {
+	Payload     *appstoreservernotifications.DecodedPayload
+	Transaction *JWSTransactionDecodedPayload
+	RenewalInfo *JWSRenewalInfoDecodedPayload
+}
+
+// VerifyAndDecodeNotificationWithInfo verifies and decodes a notification signedPayload
+// along with the signedTransactionInfo and signedRenewalInfo it contains
+func (v *SignedDataVerifier) VerifyAndDecodeNotificationWithInfo(signedPayload string) (*Notification, error) {
+	payload, err := v.VerifyAndDecodeNotification(signedPayload)
+	if err != nil {
+		return nil, err
+	}
+	return v.decodeNotificationInfo(payload)
+}
+
+// decodeNotificationInfo verifies and decodes the signed infos of an already verified payload
+func (v *SignedDataVerifier) decodeNotificationInfo(payload *appstoreservernotifications.DecodedPayload) (*Notification, error) {
+	notification := Notification{Payload: payload}
+	if payload.Data == nil {
+		return &notification, nil
+	}
+
+	if payload.Data.SignedTransactionInfo != "" {
+		transaction, err := v.VerifyAndDecodeSignedTransaction(payload.Data.SignedTransactionInfo)
+		if err != nil {
+			return nil, fmt.Errorf("SignedTransactionInfo failed to verify and decode: %w", err)
+		}
+		notification.Transaction = transaction
+	}
+
+	if payload.Data.SignedRenewalInfo != "" {
+		renewalInfo, err := v.VerifyAndDecodeRenewalInfo(payload.Data.SignedRenewalInfo)
+		if err != nil {
+			return nil, fmt.Errorf("SignedRenewalInfo failed to verify and decode: %w", err)
+		}
+		notification.RenewalInfo = renewalInfo
+	}
+
+	return &notification, nil
+}
+
+// NotificationHandlerFunc processes a verified notification. Returning an error makes the
+// handler respond with a failure status so that the App Store retries the notification.
+type NotificationHandlerFunc func(ctx context.Context, notification *Notification) error
+
+// NotificationHandlerOption is a function type for configuring NotificationHandler
+type NotificationHandlerOption func(*NotificationHandler)
+
+// WithMaxBodySize sets the maximum accepted request body size in bytes
+func WithMaxBodySize(val int64) NotificationHandlerOption {
+	return func(h *NotificationHandler) {
+		h.maxBodySize = val
+	}
+}
+
+// WithIdempotencyStore skips notifications the store records as processed and records the outcome of the others
+func WithIdempotencyStore(store appstoreservernotifications.IdempotencyStore) NotificationHandlerOption {
+	return func(h *NotificationHandler) {
+		h.store = store
+	}
+}
+
+// NotificationHandler is an http.Handler receiving App Store Server Notifications V2.
+// It responds with 200 only when the notification was verified and handled successfully.
+// See https://developer.apple.com/documentation/appstoreservernotifications/responding-to-app-store-server-notifications
+type NotificationHandler struct {
+	verifier    *SignedDataVerifier
+	handle      NotificationHandlerFunc
+	maxBodySize int64
+	store       appstoreservernotifications.IdempotencyStore
+}
+
+// NewNotificationHandler creates a new NotificationHandler verifying notifications with verifier
+func NewNotificationHandler(verifier *SignedDataVerifier, handle NotificationHandlerFunc, options ...NotificationHandlerOption) *NotificationHandler {
+	h := NotificationHandler{
+		verifier:    verifier,
+		handle:      handle,
+		maxBodySize: DefaultMaxNotificationBodySize,
+	}
+	for _, option := range options {
+		option(&h)
+	}
+	return &h
+}
+
+// ServeHTTP implements http.Handler
+func (h *NotificationHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.maxBodySize))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "failed to read request body", http.StatusBadRequest)
+		return
+	}
+
+	var responseBody appstoreservernotifications.ResponseBody
+	if err := json.Unmarshal(body, &responseBody); err != nil || responseBody.SignedPayload == "" {
+		http.Error(w, "invalid notification body", http.StatusBadRequest)
+		return
+	}
+
+	notification, err := h.verifier.VerifyAndDecodeNotificationWithInfo(responseBody.SignedPayload)
+	if err != nil {
+		http.Error(w, "failed to verify notification", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := processNotification(r.Context(), h.store, notification, h.handle); err != nil {
+		// A non 2xx response makes the App Store retry the notification later
+		if errors.Is(err, errNotificationInProgress) {
+			http.Error(w, "notification is being processed", http.StatusConflict)
+			return
+		}
+		http.Error(w, "failed to handle notification", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// errNotificationInProgress is returned for a notification claimed by a concurrent delivery
+var errNotificationInProgress = errors.New("notification is being processed")
+
+// processNotification claims the notification in store and calls handle unless it was processed
+// or is being processed by another delivery, then records the outcome in store.
+// It returns false if the notification was skipped, with errNotificationInProgress in the latter case.
+func processNotification(ctx context.Context, store appstoreservernotifications.IdempotencyStore, notification *Notification, handle NotificationHandlerFunc) (bool, error) {
+	if store == nil || notification.Payload.NotificationUUID == "" {
+		return true, handle(ctx, notification)
+	}
+
+	record, claimed, err := store.Claim(ctx, appstoreservernotifications.NewProcessingRecord(notification.Payload))
+	if err != nil {
+		return false, fmt.Errorf("failed to claim processing record: %w", err)
+	}
+	if !claimed {
+		if record.IsProcessed() {
+			return false, nil
+		}
+		return false, errNotificationInProgress
+	}
+
+	// A panicking handler fails the claim, so redeliveries don't wait for it to time out
+	handled := false
+	defer func() {
+		if !handled {
+			record.Status = appstoreservernotifications.ProcessingStatusFailed
+			record.Error = "handler panicked"
+			_ = store.Put(context.WithoutCancel(ctx), record)
+		}
+	}()
+
+	handleErr := handle(ctx, notification)
+	handled = true
+	if handleErr != nil {
+		record.Status = appstoreservernotifications.ProcessingStatusFailed
+		record.Error = handleErr.Error()
+	} else {
+		record.Status = appstoreservernotifications.ProcessingStatusSucceeded
+		record.Error = ""
+		record.ProcessedDate = time.Now()
+	}
+
+	if err := store.Put(ctx, record); err != nil {
+		return true, errors.Join(handleErr, fmt.Errorf("failed to put processing record: %w", err))
+	}
+	return true, handleErr
+}
+
+// NotificationRouter dispatches verified notifications by NotificationType and Subtype
+// to handlers receiving the decoded transaction and renewal info
+type NotificationRouter = appstoreservernotifications.Router[*JWSTransactionDecodedPayload, *JWSRenewalInfoDecodedPayload]
+
+// NewNotificationRouter creates a new NotificationRouter
+func NewNotificationRouter() *NotificationRouter {
+	return appstoreservernotifications.NewRouter[*JWSTransactionDecodedPayload, *JWSRenewalInfoDecodedPayload]()
+}
+
+// RouteNotifications returns a NotificationHandlerFunc dispatching notifications with router
+func RouteNotifications(router *NotificationRouter) NotificationHandlerFunc {
+	return func(ctx context.Context, notification *Notification) error {
+		return router.Dispatch(ctx, notification.Payload, notification.Transaction, notification.RenewalInfo)
+	}
+}
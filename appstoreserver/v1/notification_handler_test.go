@@ -0,0 +1,317 @@
+package appstoreserver
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gh73962/appleapis/appstoreservernotifications/v2"
+)
+
+func mockNotificationWithInfo(t *testing.T) string {
+	t.Helper()
+
+	signedTransaction, err := mockSignedData("models/signedTransaction.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signedRenewalInfo, err := mockSignedData("models/signedRenewalInfo.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signedNotification, err := mockSignedNotification("models/signedNotification.json", map[string]interface{}{
+		"signedTransactionInfo": signedTransaction,
+		"signedRenewalInfo":     signedRenewalInfo,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signedNotification
+}
+
+func TestVerifyAndDecodeNotificationWithInfo(t *testing.T) {
+	client, err := mockTestClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	notification, err := client.Verifier.VerifyAndDecodeNotificationWithInfo(mockNotificationWithInfo(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if notification.Payload.NotificationUUID != "002e14d5-51f5-4503-b5a8-c3a1af68eb20" {
+		t.Fatalf("expected %q, got %q", "002e14d5-51f5-4503-b5a8-c3a1af68eb20", notification.Payload.NotificationUUID)
+	}
+	if notification.Transaction == nil || notification.Transaction.ProductID != "com.example.product" {
+		t.Fatalf("expected decoded transaction, got %+v", notification.Transaction)
+	}
+	if notification.RenewalInfo == nil || notification.RenewalInfo.OriginalTransactionID != "12345" {
+		t.Fatalf("expected decoded renewal info, got %+v", notification.RenewalInfo)
+	}
+}
+
+func TestNotificationHandler(t *testing.T) {
+	client, err := mockTestClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signedNotification := mockNotificationWithInfo(t)
+
+	tests := []struct {
+		name       string
+		method     string
+		body       string
+		handleErr  error
+		options    []NotificationHandlerOption
+		wantStatus int
+		wantCalled bool
+	}{
+		{"success", http.MethodPost, `{"signedPayload":"` + signedNotification + `"}`, nil, nil, http.StatusOK, true},
+		{"handler failure", http.MethodPost, `{"signedPayload":"` + signedNotification + `"}`, errors.New("database down"), nil, http.StatusInternalServerError, true},
+		{"wrong method", http.MethodGet, "", nil, nil, http.StatusMethodNotAllowed, false},
+		{"invalid json", http.MethodPost, `{"signedPayload":`, nil, nil, http.StatusBadRequest, false},
+		{"missing payload", http.MethodPost, `{}`, nil, nil, http.StatusBadRequest, false},
+		{"invalid payload", http.MethodPost, `{"signedPayload":"not.a.jwt"}`, nil, nil, http.StatusBadRequest, false},
+		{"body too large", http.MethodPost, `{"signedPayload":"` + signedNotification + `"}`, nil, []NotificationHandlerOption{WithMaxBodySize(64)}, http.StatusRequestEntityTooLarge, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var called bool
+			handler := NewNotificationHandler(client.Verifier, func(ctx context.Context, notification *Notification) error {
+				called = true
+				if notification.Transaction == nil || notification.RenewalInfo == nil {
+					t.Fatal("expected decoded transaction and renewal info")
+				}
+				return tt.handleErr
+			}, tt.options...)
+
+			req := httptest.NewRequest(tt.method, "/notifications", strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d", tt.wantStatus, rec.Code)
+			}
+			if called != tt.wantCalled {
+				t.Fatalf("expected called %v, got %v", tt.wantCalled, called)
+			}
+		})
+	}
+}
+
+func TestNotificationHandlerServer(t *testing.T) {
+	client, err := mockTestClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	received := make(chan *Notification, 1)
+	server := httptest.NewServer(NewNotificationHandler(client.Verifier, func(ctx context.Context, notification *Notification) error {
+		received <- notification
+		return nil
+	}))
+	defer server.Close()
+
+	resp, err := http.Post(server.URL, "application/json", strings.NewReader(`{"signedPayload":"`+mockNotificationWithInfo(t)+`"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+	notification := <-received
+	if notification.Payload.NotificationType != "SUBSCRIBED" {
+		t.Fatalf("expected %q, got %q", "SUBSCRIBED", notification.Payload.NotificationType)
+	}
+}
+
+func TestNotificationHandlerWithRouter(t *testing.T) {
+	client, err := mockTestClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var transaction *JWSTransactionDecodedPayload
+	router := NewNotificationRouter().
+		OnSubscribed(appstoreservernotifications.SubtypeInitialBuy, func(ctx context.Context, payload *appstoreservernotifications.DecodedPayload, tx *JWSTransactionDecodedPayload, renewalInfo *JWSRenewalInfoDecodedPayload) error {
+			transaction = tx
+			return nil
+		})
+
+	handler := NewNotificationHandler(client.Verifier, RouteNotifications(router))
+	req := httptest.NewRequest(http.MethodPost, "/notifications", strings.NewReader(`{"signedPayload":"`+mockNotificationWithInfo(t)+`"}`))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	if transaction == nil || transaction.ProductID != "com.example.product" {
+		t.Fatalf("expected routed transaction, got %+v", transaction)
+	}
+}
+
+func TestNotificationHandlerWithIdempotencyStore(t *testing.T) {
+	client, err := mockTestClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := appstoreservernotifications.NewMemoryIdempotencyStore(time.Hour)
+	calls := 0
+	handleErr := errors.New("database down")
+	handler := NewNotificationHandler(client.Verifier, func(ctx context.Context, notification *Notification) error {
+		calls++
+		return handleErr
+	}, WithIdempotencyStore(store))
+
+	body := `{"signedPayload":"` + mockNotificationWithInfo(t) + `"}`
+	deliver := func(wantStatus int) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/notifications", strings.NewReader(body)))
+		if rec.Code != wantStatus {
+			t.Fatalf("expected status %d, got %d", wantStatus, rec.Code)
+		}
+	}
+
+	deliver(http.StatusInternalServerError)
+	record, err := store.Get(context.Background(), "002e14d5-51f5-4503-b5a8-c3a1af68eb20")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record == nil || record.Status != appstoreservernotifications.ProcessingStatusFailed || record.Error != "database down" {
+		t.Fatalf("expected failed record, got %+v", record)
+	}
+
+	handleErr = nil
+	deliver(http.StatusOK)
+	deliver(http.StatusOK)
+	if calls != 2 {
+		t.Fatalf("expected %d calls, got %d", 2, calls)
+	}
+
+	record, err = store.Get(context.Background(), "002e14d5-51f5-4503-b5a8-c3a1af68eb20")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !record.IsProcessed() || record.Attempts != 2 || record.ProcessedDate.IsZero() || record.FirstAttemptDate.After(record.LastAttemptDate) {
+		t.Fatalf("expected processed record after 2 attempts, got %+v", record)
+	}
+	if record.NotificationType != appstoreservernotifications.TypeSubscribed {
+		t.Fatalf("expected %q, got %q", appstoreservernotifications.TypeSubscribed, record.NotificationType)
+	}
+}
+
+func TestNotificationHandlerConcurrentDelivery(t *testing.T) {
+	client, err := mockTestClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := appstoreservernotifications.NewMemoryIdempotencyStore(time.Hour)
+	var calls atomic.Int64
+	started, release := make(chan struct{}), make(chan struct{})
+	handler := NewNotificationHandler(client.Verifier, func(ctx context.Context, notification *Notification) error {
+		if calls.Add(1) == 1 {
+			close(started)
+		}
+		<-release
+		return nil
+	}, WithIdempotencyStore(store))
+
+	body := `{"signedPayload":"` + mockNotificationWithInfo(t) + `"}`
+	deliver := func() int {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/notifications", strings.NewReader(body)))
+		return rec.Code
+	}
+
+	// A retry from the App Store racing the first delivery is rejected while it is being handled
+	first := make(chan int)
+	go func() { first <- deliver() }()
+	<-started
+
+	var wg sync.WaitGroup
+	codes := make([]int, 8)
+	for i := range codes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes[i] = deliver()
+		}()
+	}
+	wg.Wait()
+	close(release)
+
+	if code := <-first; code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, code)
+	}
+	for _, code := range codes {
+		if code != http.StatusConflict {
+			t.Fatalf("expected status %d, got %d", http.StatusConflict, code)
+		}
+	}
+	if code := deliver(); code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, code)
+	}
+	if calls := calls.Load(); calls != 1 {
+		t.Fatalf("expected %d call, got %d", 1, calls)
+	}
+}
+
+func TestNotificationHandlerPanicReleasesClaim(t *testing.T) {
+	client, err := mockTestClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := appstoreservernotifications.NewMemoryIdempotencyStore(time.Hour)
+	panicking := true
+	handler := NewNotificationHandler(client.Verifier, func(ctx context.Context, notification *Notification) error {
+		if panicking {
+			panic("handler bug")
+		}
+		return nil
+	}, WithIdempotencyStore(store))
+
+	body := `{"signedPayload":"` + mockNotificationWithInfo(t) + `"}`
+	deliver := func() int {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/notifications", strings.NewReader(body)))
+		return rec.Code
+	}
+
+	func() {
+		defer func() {
+			if r := recover(); r == nil {
+				t.Fatal("expected the handler panic to propagate")
+			}
+		}()
+		deliver()
+	}()
+
+	record, err := store.Get(context.Background(), "002e14d5-51f5-4503-b5a8-c3a1af68eb20")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record == nil || record.Status != appstoreservernotifications.ProcessingStatusFailed {
+		t.Fatalf("expected failed record, got %+v", record)
+	}
+
+	// The redelivery doesn't wait for the claim timeout
+	panicking = false
+	if code := deliver(); code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, code)
+	}
+}
@@ -1,7 +1,9 @@
 package appstoreserver
 
 import (
+	"io/fs"
 	"net/http"
+	"time"
 )
 
 // Option is a function type for configuring Client
@@ -56,12 +58,61 @@ func WithRootCertificates(val [][]byte) Option {
 	}
 }
 
+// WithRootCertificatesFS loads the root certificates from the .cer and .der files in the root directory of fsys,
+// embed them with go:embed so New performs no network I/O
+func WithRootCertificatesFS(fsys fs.FS) Option {
+	return func(c *ClientConfig) {
+		c.RootCertificatesFS = fsys
+	}
+}
+
+// WithEmbeddedAppleRootCertificates uses the Apple root certificates embedded in this package,
+// so New performs no network I/O
+func WithEmbeddedAppleRootCertificates() Option {
+	return func(c *ClientConfig) {
+		c.RootCertificatesFS = AppleRootCertificatesFS()
+	}
+}
+
 func WithEnableOnlineChecks() Option {
 	return func(config *ClientConfig) {
 		config.EnableOnlineChecks = true
 	}
 }
 
+// WithInsecureSkipRootPinning trusts the root certificate of the x5c header instead of the configured
+// root certificates, only use it for testing
+func WithInsecureSkipRootPinning() Option {
+	return func(config *ClientConfig) {
+		config.InsecureSkipRootPinning = true
+	}
+}
+
+// WithAcceptedEnvironments makes the verifier accept signed data from these environments
+// in addition to the configured one instead of failing with VerificationStatusInvalidEnvironment
+func WithAcceptedEnvironments(vals ...Environment) Option {
+	return func(c *ClientConfig) {
+		c.AcceptedEnvironments = append(c.AcceptedEnvironments, vals...)
+	}
+}
+
+// WithChainCache sets the number of verified certificate chains cached by the verifier and for how long,
+// a negative size disables caching
+func WithChainCache(size int, ttl time.Duration) Option {
+	return func(c *ClientConfig) {
+		c.ChainCacheSize = size
+		c.ChainCacheTTL = ttl
+	}
+}
+
+// WithRevocationChecker sets how the revocation status of certificate chains is checked,
+// e.g. a CRLRevocationChecker for hosts without access to Apple's OCSP responders
+func WithRevocationChecker(checker RevocationChecker) Option {
+	return func(c *ClientConfig) {
+		c.RevocationChecker = checker
+	}
+}
+
 // WithHTTPClient sets a custom HTTP client for API requests
 func WithHTTPClient(client *http.Client) Option {
 	return func(c *ClientConfig) {
@@ -75,3 +126,43 @@ func WithEnableAutoDecode() Option {
 		config.EnableAutoDecode = true
 	}
 }
+
+// WithDecodePolicy sets how auto-decode handles signed transactions failing verification
+func WithDecodePolicy(policy DecodePolicy) Option {
+	return func(config *ClientConfig) {
+		config.DecodePolicy = policy
+	}
+}
+
+// WithRetryPolicy enables retries of failed API requests, use DefaultRetryPolicy for the default settings
+func WithRetryPolicy(policy *RetryPolicy) Option {
+	return func(c *ClientConfig) {
+		c.RetryPolicy = policy
+	}
+}
+
+// WithTokenLifetime sets the lifetime of the cached API bearer token, capped at 60 minutes
+func WithTokenLifetime(val time.Duration) Option {
+	return func(c *ClientConfig) {
+		c.TokenLifetime = val
+	}
+}
+
+// WithBaseURL sends API requests to val instead of the environment's App Store Server API host,
+// e.g. an egress proxy, a recording proxy or a local fake server
+func WithBaseURL(val string) Option {
+	return func(c *ClientConfig) {
+		c.BaseURL = val
+	}
+}
+
+// WithEnvironmentBaseURL sends API requests of the given environment to val,
+// it can be passed for several environments to share options between clients
+func WithEnvironmentBaseURL(environment Environment, val string) Option {
+	return func(c *ClientConfig) {
+		if c.BaseURLs == nil {
+			c.BaseURLs = make(map[Environment]string)
+		}
+		c.BaseURLs[environment] = val
+	}
+}
@@ -0,0 +1,134 @@
+package appstoreserver
+
+import (
+	"context"
+	"fmt"
+	"iter"
+)
+
+// AllTransactions iterates over a customer's transaction history page by page, yielding decoded transactions.
+// After every fully consumed page req.Revision is set to the revision of the next page,
+// so a crawl stopped by breaking out of the loop can resume later with the same request.
+// Iteration stops at the first error, except for the *DecodeError of a transaction failing verification
+// with a lenient DecodePolicy, which is yielded after the valid transactions of its page.
+func (c *Client) AllTransactions(ctx context.Context, req *TransactionHistoryRequest) iter.Seq2[*JWSTransactionDecodedPayload, error] {
+	return func(yield func(*JWSTransactionDecodedPayload, error) bool) {
+		for {
+			response, err := c.GetTransactionHistory(ctx, req)
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+
+			payloads, decodeErrors, err := c.decodeTransactionPage(ctx, response.SignedTransactions, response.Payloads, response.DecodeErrors)
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			if !yieldTransactionPage(yield, payloads, decodeErrors) {
+				return
+			}
+
+			req.Revision = response.Revision
+			if !response.HasMore {
+				return
+			}
+		}
+	}
+}
+
+// RefundHistoryRequest contains information for iterating over refund history with AllRefunds.
+// See https://developer.apple.com/documentation/appstoreserverapi/get-refund-history
+type RefundHistoryRequest struct {
+	TransactionID string
+	Revision      string
+}
+
+// AllRefunds iterates over a customer's refunded in-app purchases page by page, yielding decoded transactions.
+// After every fully consumed page req.Revision is set to the revision of the next page.
+// Errors are handled as with AllTransactions.
+func (c *Client) AllRefunds(ctx context.Context, req *RefundHistoryRequest) iter.Seq2[*JWSTransactionDecodedPayload, error] {
+	return func(yield func(*JWSTransactionDecodedPayload, error) bool) {
+		for {
+			response, err := c.GetRefundHistory(ctx, req.TransactionID, req.Revision)
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+
+			payloads, decodeErrors, err := c.decodeTransactionPage(ctx, response.SignedTransactions, response.Payloads, response.DecodeErrors)
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			if !yieldTransactionPage(yield, payloads, decodeErrors) {
+				return
+			}
+
+			req.Revision = response.Revision
+			if !response.HasMore {
+				return
+			}
+		}
+	}
+}
+
+// AllNotifications iterates over the notification history page by page, yielding items with decoded payloads.
+// After every fully consumed page req.PaginationToken is set to the token of the next page.
+// Iteration stops at the first error.
+func (c *Client) AllNotifications(ctx context.Context, req *NotificationHistoryRequest) iter.Seq2[*NotificationHistoryResponseItem, error] {
+	return func(yield func(*NotificationHistoryResponseItem, error) bool) {
+		for {
+			response, err := c.GetNotificationHistory(ctx, req)
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+
+			for i := range response.NotificationHistory {
+				item := &response.NotificationHistory[i]
+				if item.Payload == nil {
+					payload, err := c.Verifier.VerifyAndDecodeNotification(item.SignedPayload)
+					if err != nil {
+						yield(nil, fmt.Errorf("SignedPayload %s\nfailed to verify and decode: %w", item.SignedPayload, err))
+						return
+					}
+					item.Payload = payload
+				}
+				if !yield(item, nil) {
+					return
+				}
+			}
+
+			req.PaginationToken = response.PaginationToken
+			if !response.HasMore {
+				return
+			}
+		}
+	}
+}
+
+// decodeTransactionPage returns the decoded transactions of a page, verifying them if the client did not auto decode
+func (c *Client) decodeTransactionPage(ctx context.Context, signedTransactions []string, payloads []*JWSTransactionDecodedPayload, decodeErrors []*DecodeError) ([]*JWSTransactionDecodedPayload, []*DecodeError, error) {
+	if len(payloads) == len(signedTransactions) || len(payloads)+len(decodeErrors) == len(signedTransactions) {
+		return payloads, decodeErrors, nil
+	}
+	return c.decodeTransactions(ctx, signedTransactions)
+}
+
+// yieldTransactionPage yields the decoded transactions of a page followed by its decode errors,
+// it reports whether the consumer wants more
+func yieldTransactionPage(yield func(*JWSTransactionDecodedPayload, error) bool, payloads []*JWSTransactionDecodedPayload, decodeErrors []*DecodeError) bool {
+	for _, payload := range payloads {
+		// Invalid transactions kept with DecodePolicyKeepRaw are yielded as their DecodeError
+		if payload != nil && !yield(payload, nil) {
+			return false
+		}
+	}
+	for _, decodeErr := range decodeErrors {
+		if !yield(nil, decodeErr) {
+			return false
+		}
+	}
+	return true
+}
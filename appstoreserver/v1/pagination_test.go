@@ -0,0 +1,285 @@
+package appstoreserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+)
+
+func mockJSONResponse(statusCode int, body any) (*http.Response, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Response{
+		StatusCode: statusCode,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(bytes.NewReader(data)),
+	}, nil
+}
+
+func TestAllTransactions(t *testing.T) {
+	signedTransaction, err := mockSignedData("models/signedTransaction.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var revisions []string
+	client, err := mockClientWithHandler(func(req *http.Request) (*http.Response, error) {
+		revision := req.URL.Query().Get("revision")
+		revisions = append(revisions, revision)
+		switch revision {
+		case "":
+			return mockJSONResponse(http.StatusOK, HistoryResponse{
+				Revision:           "revision_1",
+				HasMore:            true,
+				SignedTransactions: []string{signedTransaction, signedTransaction},
+			})
+		case "revision_1":
+			return mockJSONResponse(http.StatusOK, HistoryResponse{
+				Revision:           "revision_2",
+				SignedTransactions: []string{signedTransaction},
+			})
+		default:
+			t.Fatalf("unexpected revision %q", revision)
+			return nil, nil
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := &TransactionHistoryRequest{TransactionID: "1234"}
+	var count int
+	for payload, err := range client.AllTransactions(context.Background(), req) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if payload.ProductID != "com.example.product" {
+			t.Fatalf("expected %q, got %q", "com.example.product", payload.ProductID)
+		}
+		count++
+	}
+
+	if count != 3 {
+		t.Fatalf("expected %d transactions, got %d", 3, count)
+	}
+	if len(revisions) != 2 {
+		t.Fatalf("expected %d requests, got %d", 2, len(revisions))
+	}
+	if req.Revision != "revision_2" {
+		t.Fatalf("expected %q, got %q", "revision_2", req.Revision)
+	}
+}
+
+func TestAllTransactionsDecodePolicy(t *testing.T) {
+	signedTransaction, err := mockSignedData("models/signedTransaction.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := mockClientWithHandler(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Query().Get("revision") == "" {
+			return mockJSONResponse(http.StatusOK, HistoryResponse{
+				Revision:           "revision_1",
+				HasMore:            true,
+				SignedTransactions: []string{signedTransaction, "not.a.jwt"},
+			})
+		}
+		return mockJSONResponse(http.StatusOK, HistoryResponse{
+			Revision:           "revision_2",
+			SignedTransactions: []string{signedTransaction},
+		})
+	}, WithDecodePolicy(DecodePolicySkipInvalid))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := &TransactionHistoryRequest{TransactionID: "1234"}
+	var count, decodeErrors int
+	for payload, err := range client.AllTransactions(context.Background(), req) {
+		var decodeErr *DecodeError
+		if errors.As(err, &decodeErr) {
+			decodeErrors++
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if payload.ProductID != "com.example.product" {
+			t.Fatalf("expected %q, got %q", "com.example.product", payload.ProductID)
+		}
+		count++
+	}
+
+	if count != 2 || decodeErrors != 1 {
+		t.Fatalf("expected %d transactions and %d decode error, got %d and %d", 2, 1, count, decodeErrors)
+	}
+	if req.Revision != "revision_2" {
+		t.Fatalf("expected %q, got %q", "revision_2", req.Revision)
+	}
+}
+
+func TestAllTransactionsStopsEarly(t *testing.T) {
+	signedTransaction, err := mockSignedData("models/signedTransaction.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var requests int
+	client, err := mockClientWithHandler(func(req *http.Request) (*http.Response, error) {
+		requests++
+		return mockJSONResponse(http.StatusOK, HistoryResponse{
+			Revision:           "revision_1",
+			HasMore:            true,
+			SignedTransactions: []string{signedTransaction, signedTransaction},
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := &TransactionHistoryRequest{TransactionID: "1234", Revision: "revision_0"}
+	for _, err := range client.AllTransactions(context.Background(), req) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		break
+	}
+
+	if requests != 1 {
+		t.Fatalf("expected %d request, got %d", 1, requests)
+	}
+	if req.Revision != "revision_0" {
+		t.Fatalf("expected the partially consumed page to be resumed from %q, got %q", "revision_0", req.Revision)
+	}
+}
+
+func TestAllTransactionsError(t *testing.T) {
+	signedTransaction, err := mockSignedData("models/signedTransaction.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var requests int
+	client, err := mockClientWithHandler(func(req *http.Request) (*http.Response, error) {
+		requests++
+		if requests == 1 {
+			return mockJSONResponse(http.StatusOK, HistoryResponse{
+				Revision:           "revision_1",
+				HasMore:            true,
+				SignedTransactions: []string{signedTransaction},
+			})
+		}
+		return mockResponse(http.StatusInternalServerError, nil, "models/apiException.json")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := &TransactionHistoryRequest{TransactionID: "1234"}
+	var (
+		count   int
+		lastErr error
+	)
+	for _, err := range client.AllTransactions(context.Background(), req) {
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		count++
+	}
+
+	if count != 1 || lastErr == nil {
+		t.Fatalf("expected one transaction and an error, got %d and %v", count, lastErr)
+	}
+	if req.Revision != "revision_1" {
+		t.Fatalf("expected %q, got %q", "revision_1", req.Revision)
+	}
+}
+
+func TestAllRefunds(t *testing.T) {
+	signedTransaction, err := mockSignedData("models/signedTransaction.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := mockClientWithHandler(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Query().Get("revision") == "" {
+			return mockJSONResponse(http.StatusOK, RefundHistoryResponse{
+				Revision:           "revision_1",
+				HasMore:            true,
+				SignedTransactions: []string{signedTransaction},
+			})
+		}
+		return mockJSONResponse(http.StatusOK, RefundHistoryResponse{
+			Revision:           "revision_2",
+			SignedTransactions: []string{signedTransaction},
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := &RefundHistoryRequest{TransactionID: "555555"}
+	var count int
+	for _, err := range client.AllRefunds(context.Background(), req) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		count++
+	}
+
+	if count != 2 {
+		t.Fatalf("expected %d refunds, got %d", 2, count)
+	}
+	if req.Revision != "revision_2" {
+		t.Fatalf("expected %q, got %q", "revision_2", req.Revision)
+	}
+}
+
+func TestAllNotifications(t *testing.T) {
+	signedNotification, err := mockSignedData("models/signedNotification.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := mockClientWithHandler(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Query().Get("paginationToken") == "" {
+			return mockJSONResponse(http.StatusOK, NotificationHistoryResponse{
+				PaginationToken:     "token_1",
+				HasMore:             true,
+				NotificationHistory: []NotificationHistoryResponseItem{{SignedPayload: signedNotification}},
+			})
+		}
+		return mockJSONResponse(http.StatusOK, NotificationHistoryResponse{
+			NotificationHistory: []NotificationHistoryResponseItem{{SignedPayload: signedNotification}},
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := &NotificationHistoryRequest{StartDate: 1698148900000, EndDate: 1698148950000}
+	var count int
+	for item, err := range client.AllNotifications(context.Background(), req) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if item.Payload == nil || item.Payload.NotificationUUID != "002e14d5-51f5-4503-b5a8-c3a1af68eb20" {
+			t.Fatalf("expected decoded payload, got %+v", item.Payload)
+		}
+		count++
+	}
+
+	if count != 2 {
+		t.Fatalf("expected %d notifications, got %d", 2, count)
+	}
+	if req.PaginationToken != "" {
+		t.Fatalf("expected empty pagination token, got %q", req.PaginationToken)
+	}
+}
@@ -0,0 +1,389 @@
+package appstoreserver
+
+import (
+	"encoding/asn1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+)
+
+const (
+	// inAppTypeID is the receipt attribute type of an in-app purchase receipt
+	inAppTypeID = 17
+	// transactionIdentifierTypeID is the in-app attribute type of the transaction identifier
+	transactionIdentifierTypeID = 1703
+	// originalTransactionIdentifierTypeID is the in-app attribute type of the original transaction identifier
+	originalTransactionIdentifierTypeID = 1705
+)
+
+var (
+	oidPKCS7SignedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+
+	purchaseInfoPattern  = regexp.MustCompile(`"purchase-info"\s+=\s+"([a-zA-Z0-9+/=]+)";`)
+	transactionIDPattern = regexp.MustCompile(`"transaction-id"\s+=\s+"([a-zA-Z0-9+/=]+)";`)
+
+	errMalformedReceipt = errors.New("malformed receipt")
+)
+
+// ReceiptUtility extracts transaction identifiers from legacy receipts so they can be used
+// with the App Store Server API, for example with GetTransactionHistory
+type ReceiptUtility struct{}
+
+// NewReceiptUtility creates a new ReceiptUtility instance
+func NewReceiptUtility() *ReceiptUtility {
+	return &ReceiptUtility{}
+}
+
+// ExtractTransactionIDFromAppReceipt extracts a transaction id from an encoded App Receipt.
+// The returned transaction id is empty if the receipt contains no in-app purchases.
+// See https://developer.apple.com/documentation/appstorereceipts
+func (r *ReceiptUtility) ExtractTransactionIDFromAppReceipt(appReceipt string) (string, error) {
+	receiptBytes, err := base64.StdEncoding.DecodeString(appReceipt)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode app receipt: %w", err)
+	}
+
+	content, err := extractPKCS7Content(receiptBytes)
+	if err != nil {
+		return "", err
+	}
+
+	receipt, _, err := readBERElement(content)
+	if err != nil {
+		return "", err
+	}
+	if !receipt.isUniversal(asn1.TagSet, true) {
+		return "", fmt.Errorf("%w: expected receipt attribute set", errMalformedReceipt)
+	}
+
+	attributes, err := receipt.children()
+	if err != nil {
+		return "", err
+	}
+	for _, attribute := range attributes {
+		attrType, value, err := parseReceiptAttribute(attribute)
+		if err != nil {
+			return "", err
+		}
+		if attrType != inAppTypeID {
+			continue
+		}
+
+		transactionID, err := extractTransactionIDFromInApp(value)
+		if err != nil {
+			return "", err
+		}
+		if transactionID != "" {
+			return transactionID, nil
+		}
+	}
+
+	return "", nil
+}
+
+// ExtractTransactionIDFromTransactionReceipt extracts a transaction id from an encoded transactional receipt.
+// The returned transaction id is empty if the receipt does not contain one.
+// See https://developer.apple.com/documentation/storekit/skpaymenttransaction/1617722-transactionreceipt
+func (r *ReceiptUtility) ExtractTransactionIDFromTransactionReceipt(transactionReceipt string) (string, error) {
+	topLevel, err := base64.StdEncoding.DecodeString(transactionReceipt)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode transaction receipt: %w", err)
+	}
+
+	match := purchaseInfoPattern.FindSubmatch(topLevel)
+	if match == nil {
+		return "", nil
+	}
+
+	innerLevel, err := base64.StdEncoding.DecodeString(string(match[1]))
+	if err != nil {
+		return "", fmt.Errorf("failed to decode purchase-info: %w", err)
+	}
+
+	innerMatch := transactionIDPattern.FindSubmatch(innerLevel)
+	if innerMatch == nil {
+		return "", nil
+	}
+
+	return string(innerMatch[1]), nil
+}
+
+// extractPKCS7Content returns the encapsulated content of a PKCS#7 SignedData object
+func extractPKCS7Content(data []byte) ([]byte, error) {
+	contentInfo, _, err := readBERElement(data)
+	if err != nil {
+		return nil, err
+	}
+	if !contentInfo.isUniversal(asn1.TagSequence, true) {
+		return nil, fmt.Errorf("%w: expected PKCS#7 content info", errMalformedReceipt)
+	}
+
+	fields, err := contentInfo.children()
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) < 2 || !fields[0].isUniversal(asn1.TagOID, false) {
+		return nil, fmt.Errorf("%w: missing PKCS#7 content type", errMalformedReceipt)
+	}
+
+	var contentType asn1.ObjectIdentifier
+	if _, err := asn1.Unmarshal(fields[0].raw, &contentType); err != nil {
+		return nil, fmt.Errorf("%w: %v", errMalformedReceipt, err)
+	}
+	if !contentType.Equal(oidPKCS7SignedData) {
+		return nil, fmt.Errorf("%w: unexpected PKCS#7 content type %s", errMalformedReceipt, contentType)
+	}
+
+	// [0] EXPLICIT SignedData
+	signedData, err := fields[1].singleChild()
+	if err != nil {
+		return nil, err
+	}
+
+	// SignedData ::= SEQUENCE { version, digestAlgorithms, encapContentInfo, ... }
+	signedDataFields, err := signedData.children()
+	if err != nil {
+		return nil, err
+	}
+	if len(signedDataFields) < 3 {
+		return nil, fmt.Errorf("%w: incomplete PKCS#7 signed data", errMalformedReceipt)
+	}
+
+	// EncapsulatedContentInfo ::= SEQUENCE { eContentType, [0] EXPLICIT eContent }
+	encapFields, err := signedDataFields[2].children()
+	if err != nil {
+		return nil, err
+	}
+	if len(encapFields) < 2 {
+		return nil, fmt.Errorf("%w: missing PKCS#7 content", errMalformedReceipt)
+	}
+
+	eContent, err := encapFields[1].singleChild()
+	if err != nil {
+		return nil, err
+	}
+
+	return eContent.octetString()
+}
+
+// parseReceiptAttribute parses a ReceiptAttribute ::= SEQUENCE { type INTEGER, version INTEGER, value OCTET STRING }
+func parseReceiptAttribute(attribute berElement) (int64, []byte, error) {
+	if !attribute.isUniversal(asn1.TagSequence, true) {
+		return 0, nil, fmt.Errorf("%w: expected receipt attribute sequence", errMalformedReceipt)
+	}
+
+	fields, err := attribute.children()
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(fields) != 3 || !fields[0].isUniversal(asn1.TagInteger, false) {
+		return 0, nil, fmt.Errorf("%w: invalid receipt attribute", errMalformedReceipt)
+	}
+
+	attrType := new(big.Int).SetBytes(fields[0].content)
+	if !attrType.IsInt64() {
+		return 0, nil, fmt.Errorf("%w: invalid receipt attribute type", errMalformedReceipt)
+	}
+
+	value, err := fields[2].octetString()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return attrType.Int64(), value, nil
+}
+
+// extractTransactionIDFromInApp returns the first transaction identifier found in an in-app purchase receipt
+func extractTransactionIDFromInApp(data []byte) (string, error) {
+	inApp, _, err := readBERElement(data)
+	if err != nil {
+		return "", err
+	}
+	if !inApp.isUniversal(asn1.TagSet, true) {
+		return "", fmt.Errorf("%w: expected in-app attribute set", errMalformedReceipt)
+	}
+
+	attributes, err := inApp.children()
+	if err != nil {
+		return "", err
+	}
+	for _, attribute := range attributes {
+		attrType, value, err := parseReceiptAttribute(attribute)
+		if err != nil {
+			return "", err
+		}
+		if attrType != transactionIdentifierTypeID && attrType != originalTransactionIdentifierTypeID {
+			continue
+		}
+
+		var transactionID string
+		if _, err := asn1.UnmarshalWithParams(value, &transactionID, "utf8"); err != nil {
+			return "", fmt.Errorf("%w: invalid transaction identifier: %v", errMalformedReceipt, err)
+		}
+		return transactionID, nil
+	}
+
+	return "", nil
+}
+
+// berElement is a single BER encoded element. Receipts generated by Xcode use
+// indefinite-length encoding, which encoding/asn1 does not support.
+type berElement struct {
+	class       int
+	tag         int
+	constructed bool
+	content     []byte
+	raw         []byte
+}
+
+func (e berElement) isUniversal(tag int, constructed bool) bool {
+	return e.class == asn1.ClassUniversal && e.tag == tag && e.constructed == constructed
+}
+
+// children parses the content of a constructed element
+func (e berElement) children() ([]berElement, error) {
+	if !e.constructed {
+		return nil, fmt.Errorf("%w: expected constructed element", errMalformedReceipt)
+	}
+
+	var (
+		elements []berElement
+		rest     = e.content
+	)
+	for len(rest) > 0 {
+		element, remaining, err := readBERElement(rest)
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, element)
+		rest = remaining
+	}
+	return elements, nil
+}
+
+// singleChild returns the only child of an explicitly tagged element
+func (e berElement) singleChild() (berElement, error) {
+	elements, err := e.children()
+	if err != nil {
+		return berElement{}, err
+	}
+	if len(elements) != 1 {
+		return berElement{}, fmt.Errorf("%w: expected a single element, got %d", errMalformedReceipt, len(elements))
+	}
+	return elements[0], nil
+}
+
+// octetString returns the value of an OCTET STRING, joining the segments of a constructed one
+func (e berElement) octetString() ([]byte, error) {
+	if e.class != asn1.ClassUniversal || e.tag != asn1.TagOctetString {
+		return nil, fmt.Errorf("%w: expected octet string", errMalformedReceipt)
+	}
+	if !e.constructed {
+		return e.content, nil
+	}
+
+	segments, err := e.children()
+	if err != nil {
+		return nil, err
+	}
+	var value []byte
+	for _, segment := range segments {
+		data, err := segment.octetString()
+		if err != nil {
+			return nil, err
+		}
+		value = append(value, data...)
+	}
+	return value, nil
+}
+
+// maxBERDepth limits how deeply indefinite-length elements may be nested
+const maxBERDepth = 32
+
+// readBERElement reads one element from data and returns it together with the remaining bytes
+func readBERElement(data []byte) (berElement, []byte, error) {
+	return readNestedBERElement(data, 0)
+}
+
+// readNestedBERElement is readBERElement for an element nested in depth indefinite-length elements
+func readNestedBERElement(data []byte, depth int) (berElement, []byte, error) {
+	if depth > maxBERDepth {
+		return berElement{}, nil, fmt.Errorf("%w: elements nested too deeply", errMalformedReceipt)
+	}
+	if len(data) < 2 {
+		return berElement{}, nil, fmt.Errorf("%w: truncated element", errMalformedReceipt)
+	}
+
+	element := berElement{
+		class:       int(data[0] >> 6),
+		constructed: data[0]&0x20 != 0,
+		tag:         int(data[0] & 0x1f),
+	}
+
+	offset := 1
+	if element.tag == 0x1f {
+		element.tag = 0
+		for {
+			if offset >= len(data) || offset > 4 {
+				return berElement{}, nil, fmt.Errorf("%w: invalid tag", errMalformedReceipt)
+			}
+			b := data[offset]
+			offset++
+			element.tag = element.tag<<7 | int(b&0x7f)
+			if b&0x80 == 0 {
+				break
+			}
+		}
+	}
+
+	if offset >= len(data) {
+		return berElement{}, nil, fmt.Errorf("%w: truncated length", errMalformedReceipt)
+	}
+	lengthByte := data[offset]
+	offset++
+
+	if lengthByte == 0x80 {
+		if !element.constructed {
+			return berElement{}, nil, fmt.Errorf("%w: indefinite length on primitive element", errMalformedReceipt)
+		}
+
+		start := offset
+		rest := data[offset:]
+		for {
+			if len(rest) >= 2 && rest[0] == 0 && rest[1] == 0 {
+				end := len(data) - len(rest)
+				element.content = data[start:end]
+				element.raw = data[:end+2]
+				return element, rest[2:], nil
+			}
+			_, remaining, err := readNestedBERElement(rest, depth+1)
+			if err != nil {
+				return berElement{}, nil, err
+			}
+			rest = remaining
+		}
+	}
+
+	length := int(lengthByte)
+	if lengthByte&0x80 != 0 {
+		numBytes := int(lengthByte & 0x7f)
+		if numBytes > 4 || offset+numBytes > len(data) {
+			return berElement{}, nil, fmt.Errorf("%w: invalid length", errMalformedReceipt)
+		}
+		length = 0
+		for _, b := range data[offset : offset+numBytes] {
+			length = length<<8 | int(b)
+		}
+		offset += numBytes
+	}
+
+	if length < 0 || offset+length > len(data) {
+		return berElement{}, nil, fmt.Errorf("%w: truncated content", errMalformedReceipt)
+	}
+
+	element.content = data[offset : offset+length]
+	element.raw = data[:offset+length]
+	return element, data[offset+length:], nil
+}
@@ -0,0 +1,189 @@
+package appstoreserver
+
+import (
+	"bytes"
+	"encoding/asn1"
+	"encoding/base64"
+	"errors"
+	"os"
+	"testing"
+)
+
+func mustMarshal(t *testing.T, val any, params string) []byte {
+	t.Helper()
+	data, err := asn1.MarshalWithParams(val, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// tlv encodes a definite-length element
+func tlv(identifier byte, content ...[]byte) []byte {
+	var body []byte
+	for _, c := range content {
+		body = append(body, c...)
+	}
+
+	var length []byte
+	switch n := len(body); {
+	case n < 0x80:
+		length = []byte{byte(n)}
+	case n <= 0xff:
+		length = []byte{0x81, byte(n)}
+	default:
+		length = []byte{0x82, byte(n >> 8), byte(n)}
+	}
+
+	out := append([]byte{identifier}, length...)
+	return append(out, body...)
+}
+
+// tlvIndefinite encodes an indefinite-length constructed element like Xcode does
+func tlvIndefinite(identifier byte, content ...[]byte) []byte {
+	out := []byte{identifier, 0x80}
+	for _, c := range content {
+		out = append(out, c...)
+	}
+	return append(out, 0x00, 0x00)
+}
+
+func receiptAttribute(t *testing.T, attrType int, value []byte) []byte {
+	return tlv(0x30, mustMarshal(t, attrType, ""), mustMarshal(t, 1, ""), tlv(0x04, value))
+}
+
+func mockAppReceipt(t *testing.T, indefinite bool, inApps ...[]byte) string {
+	t.Helper()
+
+	attributes := [][]byte{
+		receiptAttribute(t, 2, mustMarshal(t, "com.example", "utf8")),
+		receiptAttribute(t, 3, mustMarshal(t, "1.0", "utf8")),
+	}
+	for _, inApp := range inApps {
+		attributes = append(attributes, receiptAttribute(t, inAppTypeID, inApp))
+	}
+	payload := tlv(0x31, attributes...)
+
+	pkcs7OID := mustMarshal(t, oidPKCS7SignedData, "")
+	dataOID := mustMarshal(t, asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}, "")
+	version := mustMarshal(t, 1, "")
+
+	var contentInfo []byte
+	if indefinite {
+		contentInfo = tlvIndefinite(0x30,
+			pkcs7OID,
+			tlvIndefinite(0xa0,
+				tlvIndefinite(0x30,
+					version,
+					tlv(0x31),
+					tlvIndefinite(0x30, dataOID, tlvIndefinite(0xa0, tlvIndefinite(0x24, tlv(0x04, payload)))),
+					tlv(0x31),
+				),
+			),
+		)
+	} else {
+		contentInfo = tlv(0x30,
+			pkcs7OID,
+			tlv(0xa0,
+				tlv(0x30,
+					version,
+					tlv(0x31),
+					tlv(0x30, dataOID, tlv(0xa0, tlv(0x04, payload))),
+					tlv(0x31),
+				),
+			),
+		)
+	}
+
+	return base64.StdEncoding.EncodeToString(contentInfo)
+}
+
+func mockInApp(t *testing.T, transactionIDType int, transactionID string) []byte {
+	return tlv(0x31,
+		receiptAttribute(t, 1702, mustMarshal(t, "com.example.product", "utf8")),
+		receiptAttribute(t, transactionIDType, mustMarshal(t, transactionID, "utf8")),
+	)
+}
+
+func TestExtractTransactionIDFromAppReceipt(t *testing.T) {
+	tests := []struct {
+		name       string
+		indefinite bool
+		inApps     [][]byte
+		want       string
+	}{
+		{"empty receipt", false, nil, ""},
+		{"transaction id", false, [][]byte{mockInApp(t, transactionIdentifierTypeID, "2000000000000001")}, "2000000000000001"},
+		{"original transaction id", false, [][]byte{mockInApp(t, originalTransactionIdentifierTypeID, "2000000000000002")}, "2000000000000002"},
+		{"first in-app wins", false, [][]byte{
+			mockInApp(t, transactionIdentifierTypeID, "2000000000000003"),
+			mockInApp(t, transactionIdentifierTypeID, "2000000000000004"),
+		}, "2000000000000003"},
+		{"xcode empty receipt", true, nil, ""},
+		{"xcode transaction id", true, [][]byte{mockInApp(t, transactionIdentifierTypeID, "0")}, "0"},
+	}
+
+	utility := NewReceiptUtility()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			receipt := mockAppReceipt(t, tt.indefinite, tt.inApps...)
+			transactionID, err := utility.ExtractTransactionIDFromAppReceipt(receipt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if transactionID != tt.want {
+				t.Fatalf("expected %q, got %q", tt.want, transactionID)
+			}
+		})
+	}
+}
+
+func TestExtractTransactionIDFromMalformedAppReceipt(t *testing.T) {
+	utility := NewReceiptUtility()
+
+	for _, receipt := range []string{
+		"not base64!",
+		base64.StdEncoding.EncodeToString([]byte{0x30, 0x05, 0x01}),
+		base64.StdEncoding.EncodeToString(mustMarshal(t, asn1.ObjectIdentifier{1, 2, 3}, "")),
+	} {
+		if _, err := utility.ExtractTransactionIDFromAppReceipt(receipt); err == nil {
+			t.Fatalf("expected error for receipt %q but got nil", receipt)
+		}
+	}
+}
+
+func TestReadBERElementDepth(t *testing.T) {
+	nested := func(depth int) []byte {
+		element := tlv(0x04, []byte("value"))
+		for range depth {
+			element = tlvIndefinite(0x30, element)
+		}
+		return element
+	}
+
+	if _, _, err := readBERElement(nested(maxBERDepth)); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := readBERElement(nested(maxBERDepth + 1)); !errors.Is(err, errMalformedReceipt) {
+		t.Fatalf("expected %v, got %v", errMalformedReceipt, err)
+	}
+	deep := append(bytes.Repeat([]byte{0x30, 0x80}, 100000), bytes.Repeat([]byte{0x00, 0x00}, 100000)...)
+	if _, _, err := readBERElement(deep); !errors.Is(err, errMalformedReceipt) {
+		t.Fatalf("expected %v, got %v", errMalformedReceipt, err)
+	}
+}
+
+func TestExtractTransactionIDFromTransactionReceipt(t *testing.T) {
+	receipt, err := os.ReadFile("../../testdata/mock_signed_data/legacyTransaction")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transactionID, err := NewReceiptUtility().ExtractTransactionIDFromTransactionReceipt(string(receipt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if transactionID != "33993399" {
+		t.Fatalf("expected %q, got %q", "33993399", transactionID)
+	}
+}
@@ -0,0 +1,294 @@
+package appstoreserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gh73962/appleapis/appstoreservernotifications/v2"
+)
+
+// NotificationHistoryWindow is how far back the App Store keeps notification history (180 days)
+const NotificationHistoryWindow = 180 * 24 * time.Hour
+
+// ReplayCheckpoint records the progress of ReplayMissedNotifications.
+// Start, End and OnlyFailures identify the replay, StartDate and EndDate are the effective
+// request range after clamping to the notification history window.
+type ReplayCheckpoint struct {
+	Start           time.Time `json:"start"`
+	End             time.Time `json:"end"`
+	OnlyFailures    bool      `json:"onlyFailures,omitempty"`
+	StartDate       int64     `json:"startDate"`
+	EndDate         int64     `json:"endDate"`
+	PaginationToken string    `json:"paginationToken,omitempty"`
+	Replayed        int       `json:"replayed"`
+	Skipped         int       `json:"skipped"`
+	Completed       bool      `json:"completed,omitempty"`
+	UpdatedDate     time.Time `json:"updatedDate"`
+}
+
+// matches reports whether the checkpoint belongs to a replay with the given parameters
+func (c *ReplayCheckpoint) matches(start, end time.Time, onlyFailures bool) bool {
+	return c != nil && c.Start.Equal(start) && c.End.Equal(end) && c.OnlyFailures == onlyFailures
+}
+
+// ReplayCheckpointStore persists the ReplayCheckpoint of a replay so that it can resume after a crash
+type ReplayCheckpointStore interface {
+	// LoadCheckpoint returns the saved checkpoint, or nil if there is none
+	LoadCheckpoint(ctx context.Context) (*ReplayCheckpoint, error)
+
+	// SaveCheckpoint replaces the saved checkpoint
+	SaveCheckpoint(ctx context.Context, checkpoint *ReplayCheckpoint) error
+}
+
+// FileReplayCheckpointStore is a ReplayCheckpointStore persisting the checkpoint to a JSON file
+type FileReplayCheckpointStore struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewFileReplayCheckpointStore creates a new FileReplayCheckpointStore writing to path
+func NewFileReplayCheckpointStore(path string) *FileReplayCheckpointStore {
+	return &FileReplayCheckpointStore{path: path}
+}
+
+// LoadCheckpoint implements ReplayCheckpointStore
+func (s *FileReplayCheckpointStore) LoadCheckpoint(ctx context.Context) (*ReplayCheckpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+
+	var checkpoint ReplayCheckpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return nil, fmt.Errorf("failed to parse checkpoint: %w", err)
+	}
+	return &checkpoint, nil
+}
+
+// SaveCheckpoint implements ReplayCheckpointStore
+func (s *FileReplayCheckpointStore) SaveCheckpoint(ctx context.Context, checkpoint *ReplayCheckpoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return fmt.Errorf("failed to encode checkpoint: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	return nil
+}
+
+// ReplayOption is a function type for configuring ReplayMissedNotifications
+type ReplayOption func(*replayConfig)
+
+type replayConfig struct {
+	checkpoints      ReplayCheckpointStore
+	store            appstoreservernotifications.IdempotencyStore
+	pageInterval     time.Duration
+	rateLimitRetries int
+}
+
+// WithReplayCheckpointStore saves a checkpoint after every page and resumes from a matching unfinished checkpoint
+func WithReplayCheckpointStore(store ReplayCheckpointStore) ReplayOption {
+	return func(c *replayConfig) {
+		c.checkpoints = store
+	}
+}
+
+// WithReplayIdempotencyStore skips notifications the store records as processed and records the outcome of the others.
+// Sharing the store with the live NotificationHandler skips notifications already received by the webhook.
+func WithReplayIdempotencyStore(store appstoreservernotifications.IdempotencyStore) ReplayOption {
+	return func(c *replayConfig) {
+		c.store = store
+	}
+}
+
+// WithReplayPageInterval waits between notification history requests to stay below the rate limit
+func WithReplayPageInterval(val time.Duration) ReplayOption {
+	return func(c *replayConfig) {
+		c.pageInterval = val
+	}
+}
+
+// WithReplayRateLimitRetries sets how many times a rate limited history request is retried, defaults to DefaultMaxRetries
+func WithReplayRateLimitRetries(val int) ReplayOption {
+	return func(c *replayConfig) {
+		c.rateLimitRetries = val
+	}
+}
+
+// ReplayMissedNotifications pages through the notification history between start and end, verifies every
+// signedPayload and feeds it to handle, the same NotificationHandlerFunc serving live notifications.
+// start is clamped to the 180 day history window and end to the current time. With onlyFailures only
+// notifications the App Store failed to deliver are replayed. Rate limited history requests are retried
+// after their Retry-After delay, or the backoff of the client's RetryPolicy without it.
+// Replay stops at the first verification or handler error, and at a notification claimed in the idempotency
+// store by another delivery. With a checkpoint store it resumes from the last fully processed page when
+// called again with the same start, end and onlyFailures.
+// See https://developer.apple.com/documentation/appstoreserverapi/get-notification-history
+func (c *Client) ReplayMissedNotifications(ctx context.Context, start, end time.Time, onlyFailures bool, handle NotificationHandlerFunc, options ...ReplayOption) (*ReplayCheckpoint, error) {
+	config := replayConfig{rateLimitRetries: DefaultMaxRetries}
+	for _, option := range options {
+		option(&config)
+	}
+
+	checkpoint, err := c.loadReplayCheckpoint(ctx, config.checkpoints, start, end, onlyFailures)
+	if err != nil {
+		return nil, err
+	}
+	if checkpoint.Completed {
+		return checkpoint, nil
+	}
+
+	req := &NotificationHistoryRequest{
+		StartDate:       checkpoint.StartDate,
+		EndDate:         checkpoint.EndDate,
+		OnlyFailures:    onlyFailures,
+		PaginationToken: checkpoint.PaginationToken,
+	}
+
+	for page := 0; ; page++ {
+		if page > 0 && config.pageInterval > 0 && !sleepContext(ctx, config.pageInterval) {
+			return checkpoint, ctx.Err()
+		}
+
+		response, err := c.getNotificationHistoryPage(ctx, req, config.rateLimitRetries)
+		if err != nil {
+			return checkpoint, err
+		}
+
+		for _, item := range response.NotificationHistory {
+			payload := item.Payload
+			if payload == nil {
+				payload, err = c.Verifier.VerifyAndDecodeNotification(item.SignedPayload)
+				if err != nil {
+					return checkpoint, fmt.Errorf("SignedPayload %s\nfailed to verify and decode: %w", item.SignedPayload, err)
+				}
+			}
+			notification, err := c.Verifier.decodeNotificationInfo(payload)
+			if err != nil {
+				return checkpoint, err
+			}
+
+			// A notification claimed by the webhook stops the replay before the checkpoint moves past it,
+			// the claim may belong to a crashed worker and only the replay would deliver it again
+			processed, err := processNotification(ctx, config.store, notification, handle)
+			if err != nil {
+				return checkpoint, fmt.Errorf("notification %s failed to replay: %w", payload.NotificationUUID, err)
+			}
+			if processed {
+				checkpoint.Replayed++
+			} else {
+				checkpoint.Skipped++
+			}
+		}
+
+		req.PaginationToken = response.PaginationToken
+		checkpoint.PaginationToken = response.PaginationToken
+		checkpoint.Completed = !response.HasMore
+		if err := saveReplayCheckpoint(ctx, config.checkpoints, checkpoint); err != nil {
+			return checkpoint, err
+		}
+		if checkpoint.Completed {
+			return checkpoint, nil
+		}
+	}
+}
+
+// getNotificationHistoryPage requests a page of the notification history, retrying rate limited requests
+// since history requests are POSTs the client's RetryPolicy doesn't retry by default
+func (c *Client) getNotificationHistoryPage(ctx context.Context, req *NotificationHistoryRequest, rateLimitRetries int) (*NotificationHistoryResponse, error) {
+	policy := c.retryPolicy
+	if policy == nil {
+		policy = DefaultRetryPolicy()
+	}
+
+	for attempt := 0; ; attempt++ {
+		response, err := c.GetNotificationHistory(ctx, req)
+		var apiErr *APIError
+		if err == nil || attempt >= rateLimitRetries || !errors.As(err, &apiErr) || !apiErr.IsRateLimited() {
+			return response, err
+		}
+
+		delay := apiErr.RetryAfter
+		if delay <= 0 {
+			delay = policy.backoff(attempt)
+		}
+		if !sleepContext(ctx, delay) {
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// loadReplayCheckpoint resumes a matching checkpoint or starts a new one within the history window
+func (c *Client) loadReplayCheckpoint(ctx context.Context, store ReplayCheckpointStore, start, end time.Time, onlyFailures bool) (*ReplayCheckpoint, error) {
+	if store != nil {
+		checkpoint, err := store.LoadCheckpoint(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if checkpoint.matches(start, end, onlyFailures) {
+			return checkpoint, nil
+		}
+	}
+
+	now := time.Now()
+	effectiveStart, effectiveEnd := start, end
+	if windowStart := now.Add(-NotificationHistoryWindow); effectiveStart.Before(windowStart) {
+		effectiveStart = windowStart
+	}
+	if effectiveEnd.After(now) {
+		effectiveEnd = now
+	}
+	if !effectiveEnd.After(effectiveStart) {
+		return nil, fmt.Errorf("replay range %s to %s is outside the notification history window", start.Format(time.RFC3339), end.Format(time.RFC3339))
+	}
+
+	return &ReplayCheckpoint{
+		Start:        start,
+		End:          end,
+		OnlyFailures: onlyFailures,
+		StartDate:    effectiveStart.UnixMilli(),
+		EndDate:      effectiveEnd.UnixMilli(),
+	}, nil
+}
+
+func saveReplayCheckpoint(ctx context.Context, store ReplayCheckpointStore, checkpoint *ReplayCheckpoint) error {
+	if store == nil {
+		return nil
+	}
+	checkpoint.UpdatedDate = time.Now()
+	if err := store.SaveCheckpoint(ctx, checkpoint); err != nil {
+		return fmt.Errorf("failed to save checkpoint: %w", err)
+	}
+	return nil
+}
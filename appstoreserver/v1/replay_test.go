@@ -0,0 +1,355 @@
+package appstoreserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gh73962/appleapis/appstoreservernotifications/v2"
+)
+
+func mockNotificationWithUUID(t *testing.T, notificationUUID string) string {
+	t.Helper()
+
+	data, err := os.ReadFile("../../testdata/models/signedNotification.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var payload map[string]interface{}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		t.Fatal(err)
+	}
+	payload["notificationUUID"] = notificationUUID
+	delete(payload["data"].(map[string]interface{}), "signedTransactionInfo")
+	delete(payload["data"].(map[string]interface{}), "signedRenewalInfo")
+
+	signedNotification, err := mockSignedPayload(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signedNotification
+}
+
+type memoryCheckpointStore struct {
+	checkpoint *ReplayCheckpoint
+}
+
+func (s *memoryCheckpointStore) LoadCheckpoint(ctx context.Context) (*ReplayCheckpoint, error) {
+	if s.checkpoint == nil {
+		return nil, nil
+	}
+	checkpoint := *s.checkpoint
+	return &checkpoint, nil
+}
+
+func (s *memoryCheckpointStore) SaveCheckpoint(ctx context.Context, checkpoint *ReplayCheckpoint) error {
+	saved := *checkpoint
+	s.checkpoint = &saved
+	return nil
+}
+
+func mockHistoryClient(t *testing.T, requests *[]NotificationHistoryRequest) *Client {
+	t.Helper()
+
+	pages := map[string]NotificationHistoryResponse{
+		"": {
+			PaginationToken: "token_1",
+			HasMore:         true,
+			NotificationHistory: []NotificationHistoryResponseItem{
+				{SignedPayload: mockNotificationWithUUID(t, "uuid_1")},
+				{SignedPayload: mockNotificationWithUUID(t, "uuid_2")},
+			},
+		},
+		"token_1": {
+			NotificationHistory: []NotificationHistoryResponseItem{
+				{SignedPayload: mockNotificationWithUUID(t, "uuid_2")},
+				{SignedPayload: mockNotificationWithUUID(t, "uuid_3")},
+			},
+		},
+	}
+
+	client, err := mockClientWithHandler(func(req *http.Request) (*http.Response, error) {
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		var historyRequest NotificationHistoryRequest
+		if err := json.Unmarshal(body, &historyRequest); err != nil {
+			return nil, err
+		}
+		historyRequest.PaginationToken = req.URL.Query().Get("paginationToken")
+		*requests = append(*requests, historyRequest)
+
+		return mockJSONResponse(http.StatusOK, pages[historyRequest.PaginationToken])
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestReplayMissedNotifications(t *testing.T) {
+	var requests []NotificationHistoryRequest
+	client := mockHistoryClient(t, &requests)
+
+	var handled []string
+	handle := func(ctx context.Context, notification *Notification) error {
+		handled = append(handled, notification.Payload.NotificationUUID)
+		return nil
+	}
+
+	now := time.Now()
+	start := now.Add(-365 * 24 * time.Hour)
+	store := appstoreservernotifications.NewMemoryIdempotencyStore(time.Hour)
+	checkpoint, err := client.ReplayMissedNotifications(context.Background(), start, now, true, handle, WithReplayIdempotencyStore(store))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(handled) != 3 || handled[0] != "uuid_1" || handled[1] != "uuid_2" || handled[2] != "uuid_3" {
+		t.Fatalf("expected [uuid_1 uuid_2 uuid_3], got %v", handled)
+	}
+	if checkpoint.Replayed != 3 || checkpoint.Skipped != 1 || !checkpoint.Completed {
+		t.Fatalf("expected 3 replayed and 1 skipped, got %+v", checkpoint)
+	}
+
+	if len(requests) != 2 {
+		t.Fatalf("expected %d requests, got %d", 2, len(requests))
+	}
+	if !requests[0].OnlyFailures || requests[1].PaginationToken != "token_1" {
+		t.Fatalf("expected onlyFailures request paged with token_1, got %+v", requests)
+	}
+	windowStart := now.Add(-NotificationHistoryWindow).UnixMilli()
+	if requests[0].StartDate < windowStart || requests[0].StartDate > windowStart+int64(time.Minute/time.Millisecond) {
+		t.Fatalf("expected startDate clamped to %d, got %d", windowStart, requests[0].StartDate)
+	}
+	if requests[1].StartDate != requests[0].StartDate || requests[1].EndDate != requests[0].EndDate {
+		t.Fatalf("expected the same range on every page, got %+v", requests)
+	}
+}
+
+func TestReplayMissedNotificationsResume(t *testing.T) {
+	var requests []NotificationHistoryRequest
+	client := mockHistoryClient(t, &requests)
+
+	failOn := "uuid_3"
+	var handled []string
+	handle := func(ctx context.Context, notification *Notification) error {
+		if notification.Payload.NotificationUUID == failOn {
+			return errors.New("database down")
+		}
+		handled = append(handled, notification.Payload.NotificationUUID)
+		return nil
+	}
+
+	checkpoints := &memoryCheckpointStore{}
+	store := appstoreservernotifications.NewMemoryIdempotencyStore(time.Hour)
+	end := time.Now()
+	start := end.Add(-24 * time.Hour)
+
+	checkpoint, err := client.ReplayMissedNotifications(context.Background(), start, end, false, handle,
+		WithReplayCheckpointStore(checkpoints), WithReplayIdempotencyStore(store))
+	if err == nil {
+		t.Fatal("expected error but got nil")
+	}
+	if checkpoint.Completed || checkpoints.checkpoint.PaginationToken != "token_1" {
+		t.Fatalf("expected checkpoint after the first page, got %+v", checkpoints.checkpoint)
+	}
+
+	failOn = ""
+	requests = nil
+	checkpoint, err = client.ReplayMissedNotifications(context.Background(), start, end, false, handle,
+		WithReplayCheckpointStore(checkpoints), WithReplayIdempotencyStore(store))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(requests) != 1 || requests[0].PaginationToken != "token_1" {
+		t.Fatalf("expected to resume from token_1, got %+v", requests)
+	}
+	if len(handled) != 3 || handled[2] != "uuid_3" {
+		t.Fatalf("expected uuid_3 to be handled on resume, got %v", handled)
+	}
+	if !checkpoint.Completed || checkpoint.Replayed != 3 || checkpoint.Skipped != 1 {
+		t.Fatalf("expected completed checkpoint, got %+v", checkpoint)
+	}
+
+	requests = nil
+	if _, err := client.ReplayMissedNotifications(context.Background(), start, end, false, handle,
+		WithReplayCheckpointStore(checkpoints)); err != nil {
+		t.Fatal(err)
+	}
+	if len(requests) != 0 {
+		t.Fatalf("expected completed replay not to request history, got %+v", requests)
+	}
+}
+
+// mockReplayClient serves a notification history page per element of pages, rate limiting the first rateLimited requests
+func mockReplayClient(t *testing.T, rateLimited int, pages ...[]string) *Client {
+	t.Helper()
+
+	responses := make(map[string]NotificationHistoryResponse)
+	for i, page := range pages {
+		response := NotificationHistoryResponse{HasMore: i < len(pages)-1}
+		if response.HasMore {
+			response.PaginationToken = "token_" + strconv.Itoa(i+1)
+		}
+		for _, notificationUUID := range page {
+			response.NotificationHistory = append(response.NotificationHistory,
+				NotificationHistoryResponseItem{SignedPayload: mockNotificationWithUUID(t, notificationUUID)})
+		}
+		token := ""
+		if i > 0 {
+			token = "token_" + strconv.Itoa(i)
+		}
+		responses[token] = response
+	}
+
+	client, err := mockClientWithHandler(func(req *http.Request) (*http.Response, error) {
+		if rateLimited > 0 {
+			rateLimited--
+			return mockJSONResponse(http.StatusTooManyRequests, APIError{ErrorCode: int(ErrRateLimitExceeded)})
+		}
+		return mockJSONResponse(http.StatusOK, responses[req.URL.Query().Get("paginationToken")])
+	}, WithRetryPolicy(&RetryPolicy{MaxRetries: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestReplayMissedNotificationsRateLimited(t *testing.T) {
+	notificationUUIDs := []string{
+		"9a9d4b0e-2c1f-4a57-8f7e-0c4b1d2e3f40",
+		"5f0c7e1a-6b2d-4c3e-9a8f-1d2e3f4a5b6c",
+		"c3d2e1f0-8a9b-4c7d-a6e5-f4a3b2c1d0e9",
+	}
+	end := time.Now()
+	start := end.Add(-24 * time.Hour)
+
+	// Notification history requests are POSTs the RetryPolicy doesn't retry, the replay waits out rate limits itself
+	client := mockReplayClient(t, 2, notificationUUIDs[:1], notificationUUIDs[1:])
+	var handled []string
+	handle := func(ctx context.Context, notification *Notification) error {
+		handled = append(handled, notification.Payload.NotificationUUID)
+		return nil
+	}
+	checkpoint, err := client.ReplayMissedNotifications(context.Background(), start, end, false, handle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !checkpoint.Completed || len(handled) != len(notificationUUIDs) {
+		t.Fatalf("expected a completed replay of %d notifications, got %v in %+v", len(notificationUUIDs), handled, checkpoint)
+	}
+
+	client = mockReplayClient(t, 2, notificationUUIDs)
+	_, err = client.ReplayMissedNotifications(context.Background(), start, end, false, handle, WithReplayRateLimitRetries(1))
+	if !errors.Is(err, ErrRateLimitExceeded) {
+		t.Fatalf("expected %v, got %v", ErrRateLimitExceeded, err)
+	}
+}
+
+func TestReplayMissedNotificationsInProgress(t *testing.T) {
+	notificationUUIDs := []string{
+		"0b7e9c2d-3f4a-4b5c-8d6e-7f8a9b0c1d2e",
+		"e1d2c3b4-a5f6-4e7d-9c8b-0a1f2e3d4c5b",
+		"7c6b5a49-3828-4716-a5f4-e3d2c1b0a9f8",
+	}
+	client := mockReplayClient(t, 0, notificationUUIDs[:2], notificationUUIDs[2:])
+
+	var handled []string
+	handle := func(ctx context.Context, notification *Notification) error {
+		handled = append(handled, notification.Payload.NotificationUUID)
+		return nil
+	}
+
+	// A webhook worker crashed while handling the second notification and left its claim
+	ctx := context.Background()
+	store := appstoreservernotifications.NewMemoryIdempotencyStore(time.Hour)
+	claim := &appstoreservernotifications.ProcessingRecord{
+		NotificationUUID: notificationUUIDs[1],
+		Status:           appstoreservernotifications.ProcessingStatusInProgress,
+		Attempts:         1,
+		LastAttemptDate:  time.Now(),
+	}
+	if err := store.Put(ctx, claim); err != nil {
+		t.Fatal(err)
+	}
+
+	checkpoints := &memoryCheckpointStore{}
+	end := time.Now()
+	start := end.Add(-24 * time.Hour)
+	_, err := client.ReplayMissedNotifications(ctx, start, end, false, handle,
+		WithReplayCheckpointStore(checkpoints), WithReplayIdempotencyStore(store))
+	if !errors.Is(err, errNotificationInProgress) {
+		t.Fatalf("expected %v, got %v", errNotificationInProgress, err)
+	}
+	if checkpoints.checkpoint != nil {
+		t.Fatalf("expected no checkpoint past the claimed notification, got %+v", checkpoints.checkpoint)
+	}
+
+	// Once the claim is stale the resumed replay takes it over
+	claim.LastAttemptDate = time.Now().Add(-appstoreservernotifications.DefaultClaimTimeout)
+	if err := store.Put(ctx, claim); err != nil {
+		t.Fatal(err)
+	}
+	checkpoint, err := client.ReplayMissedNotifications(ctx, start, end, false, handle,
+		WithReplayCheckpointStore(checkpoints), WithReplayIdempotencyStore(store))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(handled) != 3 || handled[1] != notificationUUIDs[1] || handled[2] != notificationUUIDs[2] {
+		t.Fatalf("expected %v to be handled, got %v", notificationUUIDs, handled)
+	}
+	if !checkpoint.Completed || checkpoint.Replayed != 2 || checkpoint.Skipped != 1 {
+		t.Fatalf("expected completed checkpoint, got %+v", checkpoint)
+	}
+}
+
+func TestReplayMissedNotificationsOutsideWindow(t *testing.T) {
+	client, err := mockTestClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	end := time.Now().Add(-200 * 24 * time.Hour)
+	_, err = client.ReplayMissedNotifications(context.Background(), end.Add(-24*time.Hour), end, false,
+		func(ctx context.Context, notification *Notification) error { return nil })
+	if err == nil {
+		t.Fatal("expected error but got nil")
+	}
+}
+
+func TestFileReplayCheckpointStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewFileReplayCheckpointStore(filepath.Join(t.TempDir(), "checkpoint.json"))
+
+	checkpoint, err := store.LoadCheckpoint(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checkpoint != nil {
+		t.Fatalf("expected nil, got %+v", checkpoint)
+	}
+
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	want := &ReplayCheckpoint{Start: start, End: start.Add(time.Hour), PaginationToken: "token_1", Replayed: 2}
+	if err := store.SaveCheckpoint(ctx, want); err != nil {
+		t.Fatal(err)
+	}
+
+	checkpoint, err = store.LoadCheckpoint(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !checkpoint.matches(want.Start, want.End, false) || checkpoint.PaginationToken != "token_1" || checkpoint.Replayed != 2 {
+		t.Fatalf("expected %+v, got %+v", want, checkpoint)
+	}
+}
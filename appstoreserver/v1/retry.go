@@ -0,0 +1,150 @@
+package appstoreserver
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+const (
+	// DefaultMaxRetries is the default number of retries after the first attempt
+	DefaultMaxRetries = 3
+	// DefaultInitialBackoff is the default backoff before the first retry
+	DefaultInitialBackoff = 500 * time.Millisecond
+	// DefaultMaxBackoff is the default upper bound of a single backoff
+	DefaultMaxBackoff = 30 * time.Second
+)
+
+// RetryPolicy configures how Client retries failed requests.
+// Rate limited requests (HTTP 429) wait for the Retry-After header when present,
+// unless it asks to wait longer than MaxBackoff, in which case the APIError is returned.
+// Server errors (HTTP 5xx) and transient network errors use exponential backoff with full jitter.
+type RetryPolicy struct {
+	// MaxRetries is the maximum number of retries after the first attempt.
+	MaxRetries int
+
+	// InitialBackoff is the backoff upper bound before the first retry,
+	// doubled after every attempt.
+	InitialBackoff time.Duration
+
+	// MaxBackoff caps the exponential backoff and the accepted Retry-After delay.
+	MaxBackoff time.Duration
+
+	// RetryNonIdempotent allows retrying requests with non-idempotent
+	// methods such as POST. Disabled by default.
+	RetryNonIdempotent bool
+}
+
+// DefaultRetryPolicy returns a RetryPolicy with the default settings
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxRetries:     DefaultMaxRetries,
+		InitialBackoff: DefaultInitialBackoff,
+		MaxBackoff:     DefaultMaxBackoff,
+	}
+}
+
+// allowsMethod reports whether requests with the given method may be retried
+func (p *RetryPolicy) allowsMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	default:
+		return p.RetryNonIdempotent
+	}
+}
+
+// maxBackoff returns the upper bound of a single backoff or Retry-After wait
+func (p *RetryPolicy) maxBackoff() time.Duration {
+	if p.MaxBackoff <= 0 {
+		return DefaultMaxBackoff
+	}
+	return p.MaxBackoff
+}
+
+// backoff returns a jittered backoff for the given zero based retry attempt
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	initial := p.InitialBackoff
+	if initial <= 0 {
+		initial = DefaultInitialBackoff
+	}
+	maxBackoff := p.maxBackoff()
+
+	backoff := initial
+	for i := 0; i < attempt && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+
+	return rand.N(backoff + 1)
+}
+
+// shouldRetryStatus reports whether a response with the given status code may succeed when retried
+func shouldRetryStatus(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests || statusCode >= http.StatusInternalServerError
+}
+
+// isTransientError reports whether err is a network error that may succeed when retried
+func isTransientError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// parseRetryAfter parses the Retry-After header, either delay seconds or an HTTP date
+func parseRetryAfter(header http.Header) (time.Duration, bool) {
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		delay := time.Until(date)
+		if delay < 0 {
+			delay = 0
+		}
+		return delay, true
+	}
+
+	return 0, false
+}
+
+// sleepContext waits for the delay and returns false if the context ends first
+// or its deadline would pass before the delay elapses
+func sleepContext(ctx context.Context, delay time.Duration) bool {
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+		return false
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
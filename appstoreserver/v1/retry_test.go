@@ -0,0 +1,244 @@
+package appstoreserver
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func testRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxRetries:     3,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     5 * time.Millisecond,
+	}
+}
+
+func TestRetryTooManyRequests(t *testing.T) {
+	var attempts int
+	client, err := mockClientWithHandler(func(req *http.Request) (*http.Response, error) {
+		attempts++
+		if attempts < 3 {
+			return mockResponse(http.StatusTooManyRequests, http.Header{"Retry-After": []string{"0"}}, "models/apiTooManyRequestsException.json")
+		}
+		return mockResponse(http.StatusOK, nil, "models/transactionInfoResponse.json")
+	}, WithRetryPolicy(testRetryPolicy()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response, err := client.GetTransactionInfo(context.Background(), "1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 3 {
+		t.Fatalf("expected %d attempts, got %d", 3, attempts)
+	}
+	if response.SignedTransactionInfo != "signed_transaction_info_value" {
+		t.Fatalf("expected %q, got %q", "signed_transaction_info_value", response.SignedTransactionInfo)
+	}
+}
+
+func TestRetryServerErrorExhausted(t *testing.T) {
+	var attempts int
+	client, err := mockClientWithHandler(func(req *http.Request) (*http.Response, error) {
+		attempts++
+		return mockResponse(http.StatusInternalServerError, nil, "models/apiException.json")
+	}, WithRetryPolicy(testRetryPolicy()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.GetTransactionInfo(context.Background(), "1234")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("expected error to be of type *APIError but got %T", err)
+	}
+	if attempts != 4 {
+		t.Fatalf("expected %d attempts, got %d", 4, attempts)
+	}
+}
+
+func TestRetryTransientNetworkError(t *testing.T) {
+	var attempts int
+	client, err := mockClientWithHandler(func(req *http.Request) (*http.Response, error) {
+		attempts++
+		if attempts == 1 {
+			return nil, syscall.ECONNRESET
+		}
+		if attempts == 2 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return mockResponse(http.StatusOK, nil, "")
+	}, WithRetryPolicy(testRetryPolicy()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := UpdateAppAccountTokenRequest{
+		OriginalTransactionID: "49571273",
+		AppAccountToken:       "7389a31a-fb6d-4569-a2a6-db7d85d84813",
+	}
+	if err := client.SetAppAccountToken(context.Background(), &req); err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 3 {
+		t.Fatalf("expected %d attempts, got %d", 3, attempts)
+	}
+}
+
+func TestRetryRequestBodyIsResent(t *testing.T) {
+	var bodies []string
+	client, err := mockClientWithHandler(func(req *http.Request) (*http.Response, error) {
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		bodies = append(bodies, string(body))
+		if len(bodies) == 1 {
+			return mockResponse(http.StatusServiceUnavailable, nil, "")
+		}
+		return mockResponse(http.StatusOK, nil, "")
+	}, WithRetryPolicy(testRetryPolicy()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := UpdateAppAccountTokenRequest{
+		OriginalTransactionID: "49571273",
+		AppAccountToken:       "7389a31a-fb6d-4569-a2a6-db7d85d84813",
+	}
+	if err := client.SetAppAccountToken(context.Background(), &req); err != nil {
+		t.Fatal(err)
+	}
+	if len(bodies) != 2 || bodies[0] != bodies[1] || bodies[0] == "" {
+		t.Fatalf("expected the same body twice, got %q", bodies)
+	}
+}
+
+func TestRetryNonIdempotentRequiresOptIn(t *testing.T) {
+	for _, optIn := range []bool{false, true} {
+		var attempts int
+		policy := testRetryPolicy()
+		policy.RetryNonIdempotent = optIn
+		client, err := mockClientWithHandler(func(req *http.Request) (*http.Response, error) {
+			attempts++
+			if attempts == 1 {
+				return mockResponse(http.StatusInternalServerError, nil, "models/apiException.json")
+			}
+			return mockResponse(http.StatusOK, nil, "models/requestTestNotificationResponse.json")
+		}, WithRetryPolicy(policy))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = client.RequestTestNotification(context.Background())
+		if optIn && (err != nil || attempts != 2) {
+			t.Fatalf("expected success after %d attempts, got %d attempts and %v", 2, attempts, err)
+		}
+		if !optIn && (err == nil || attempts != 1) {
+			t.Fatalf("expected failure after %d attempt, got %d attempts and %v", 1, attempts, err)
+		}
+	}
+}
+
+func TestRetryDoesNotRetryClientErrors(t *testing.T) {
+	var attempts int
+	client, err := mockClientWithHandler(func(req *http.Request) (*http.Response, error) {
+		attempts++
+		return mockResponse(http.StatusBadRequest, nil, "models/invalidAppAccountTokenUUIDError.json")
+	}, WithRetryPolicy(testRetryPolicy()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.GetTransactionInfo(context.Background(), "1234"); err == nil {
+		t.Fatal("expected error but got nil")
+	}
+	if attempts != 1 {
+		t.Fatalf("expected %d attempt, got %d", 1, attempts)
+	}
+}
+
+func TestRetryRespectsContextDeadline(t *testing.T) {
+	var attempts int
+	client, err := mockClientWithHandler(func(req *http.Request) (*http.Response, error) {
+		attempts++
+		return mockResponse(http.StatusTooManyRequests, http.Header{"Retry-After": []string{"60"}}, "models/apiTooManyRequestsException.json")
+	}, WithRetryPolicy(testRetryPolicy()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	start := time.Now()
+	_, err = client.GetTransactionInfo(ctx, "1234")
+	if err == nil {
+		t.Fatal("expected error but got nil")
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Fatalf("expected to give up before the deadline, took %v", time.Since(start))
+	}
+	if attempts != 1 {
+		t.Fatalf("expected %d attempt, got %d", 1, attempts)
+	}
+}
+
+func TestRetryAfterLongerThanMaxBackoff(t *testing.T) {
+	var attempts int
+	client, err := mockClientWithHandler(func(req *http.Request) (*http.Response, error) {
+		attempts++
+		return mockResponse(http.StatusTooManyRequests, http.Header{"Retry-After": []string{"86400"}}, "models/apiTooManyRequestsException.json")
+	}, WithRetryPolicy(testRetryPolicy()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	_, err = client.GetTransactionInfo(context.Background(), "1234")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.RetryAfter != 24*time.Hour {
+		t.Fatalf("expected rate limit error with Retry-After, got %v", err)
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Fatalf("expected to give up immediately, took %v", time.Since(start))
+	}
+	if attempts != 1 {
+		t.Fatalf("expected %d attempt, got %d", 1, attempts)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"", 0, false},
+		{"5", 5 * time.Second, true},
+		{"-1", 0, false},
+		{"invalid", 0, false},
+		{time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat), 0, true},
+	}
+	for _, tt := range tests {
+		got, ok := parseRetryAfter(http.Header{"Retry-After": []string{tt.value}})
+		if got != tt.want || ok != tt.ok {
+			t.Fatalf("Retry-After %q: expected (%v, %v), got (%v, %v)", tt.value, tt.want, tt.ok, got, ok)
+		}
+	}
+}
+
+func TestRetryBackoffIsBounded(t *testing.T) {
+	policy := &RetryPolicy{InitialBackoff: 10 * time.Millisecond, MaxBackoff: 40 * time.Millisecond}
+	for attempt := range 10 {
+		if backoff := policy.backoff(attempt); backoff < 0 || backoff > 40*time.Millisecond {
+			t.Fatalf("attempt %d: backoff %v out of bounds", attempt, backoff)
+		}
+	}
+}
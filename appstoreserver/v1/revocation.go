@@ -0,0 +1,387 @@
+package appstoreserver
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+const (
+	// RevocationCheckTimeout limits how long the revocation checks of a certificate chain take
+	RevocationCheckTimeout = 10 * time.Second
+	// DefaultCRLRefreshInterval is how often CRLRevocationChecker refreshes its CRLs by default
+	DefaultCRLRefreshInterval = time.Hour
+)
+
+// ErrCertificateRevoked is returned by revocation checkers when a certificate was revoked
+var ErrCertificateRevoked = errors.New("certificate was revoked")
+
+// RevocationChecker checks the revocation status of the certificates of a verified chain
+type RevocationChecker interface {
+	// CheckRevocation returns an error if cert, issued by issuer, was revoked or its status can't be determined
+	CheckRevocation(ctx context.Context, cert, issuer *x509.Certificate) error
+}
+
+// NoopRevocationChecker doesn't check revocation
+type NoopRevocationChecker struct{}
+
+// CheckRevocation implements RevocationChecker
+func (NoopRevocationChecker) CheckRevocation(context.Context, *x509.Certificate, *x509.Certificate) error {
+	return nil
+}
+
+// OCSPRevocationChecker queries the OCSP responders listed in each certificate,
+// it is used when EnableOnlineChecks is set without a RevocationChecker
+type OCSPRevocationChecker struct {
+	// HTTPClient sends the OCSP requests. If nil, the ClientConfig.HTTPClient of the verifier checking
+	// a chain is used, or http.DefaultClient when the checker is called directly.
+	HTTPClient *http.Client
+}
+
+// CheckRevocation implements RevocationChecker
+func (o *OCSPRevocationChecker) CheckRevocation(ctx context.Context, cert, issuer *x509.Certificate) error {
+	response, err := o.fetch(ctx, cert, issuer)
+	if err != nil {
+		return err
+	}
+	return ocspStatusError(response)
+}
+
+// fetch queries the OCSP responders of cert and returns the first response verified with issuer
+func (o *OCSPRevocationChecker) fetch(ctx context.Context, cert, issuer *x509.Certificate) (*ocsp.Response, error) {
+	ocspRequest, err := ocsp.CreateRequest(cert, issuer, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OCSP request: %w", err)
+	}
+
+	if len(cert.OCSPServer) == 0 {
+		return nil, errors.New("no OCSP server URLs found in certificate")
+	}
+
+	var errs []error
+	for _, serverURL := range cert.OCSPServer {
+		raw, err := o.query(ctx, serverURL, ocspRequest)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		response, err := ocsp.ParseResponseForCert(raw, cert, issuer)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid OCSP response from %s: %w", serverURL, err))
+			continue
+		}
+		return response, nil
+	}
+
+	return nil, fmt.Errorf("failed to verify certificate status via OCSP: %w", errors.Join(errs...))
+}
+
+// query sends an OCSP request to serverURL and returns the raw response
+func (o *OCSPRevocationChecker) query(ctx context.Context, serverURL string, request []byte) ([]byte, error) {
+	if _, err := url.Parse(serverURL); err != nil {
+		return nil, fmt.Errorf("invalid OCSP server URL: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, serverURL, bytes.NewReader(request))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OCSP request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/ocsp-request")
+
+	httpClient := o.HTTPClient
+	if httpClient == nil {
+		httpClient = contextHTTPClient(ctx)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send OCSP request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("OCSP server returned status: %d", resp.StatusCode)
+	}
+
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read OCSP response: %w", err)
+	}
+	return responseBody, nil
+}
+
+type httpClientContextKey struct{}
+
+// withHTTPClient returns a context passing httpClient to the revocation checks of a verifier
+func withHTTPClient(ctx context.Context, httpClient *http.Client) context.Context {
+	if httpClient == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, httpClientContextKey{}, httpClient)
+}
+
+// contextHTTPClient returns the HTTP client of the verifier checking revocation, http.DefaultClient without one
+func contextHTTPClient(ctx context.Context) *http.Client {
+	if httpClient, ok := ctx.Value(httpClientContextKey{}).(*http.Client); ok {
+		return httpClient
+	}
+	return http.DefaultClient
+}
+
+// ocspStatusError returns nil if response reports a good certificate
+func ocspStatusError(response *ocsp.Response) error {
+	switch response.Status {
+	case ocsp.Good:
+		return nil
+	case ocsp.Revoked:
+		return fmt.Errorf("%w at %s", ErrCertificateRevoked, response.RevokedAt.Format(time.RFC3339))
+	default:
+		return fmt.Errorf("certificate status is not good: %d", response.Status)
+	}
+}
+
+// CachingOCSPRevocationChecker queries OCSP responders like OCSPRevocationChecker and caches
+// the responses until their next update. Responses obtained out of band, e.g. by a sidecar
+// with network access, can be stapled so no OCSP responder is queried for their certificates.
+type CachingOCSPRevocationChecker struct {
+	OCSPRevocationChecker
+
+	// MaxAge limits how long a response is used after it was produced, unlimited if zero
+	MaxAge time.Duration
+
+	mu        sync.Mutex
+	responses map[string]*ocsp.Response
+	stapled   map[string][]byte
+	now       func() time.Time
+}
+
+// Staple adds a DER encoded OCSP response, it is verified against the issuer when its certificate is checked
+func (c *CachingOCSPRevocationChecker) Staple(raw []byte) error {
+	response, err := ocsp.ParseResponse(raw, nil)
+	if err != nil {
+		return fmt.Errorf("invalid OCSP response: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stapled == nil {
+		c.stapled = make(map[string][]byte)
+	}
+	c.stapled[response.SerialNumber.String()] = raw
+	return nil
+}
+
+// CheckRevocation implements RevocationChecker
+func (c *CachingOCSPRevocationChecker) CheckRevocation(ctx context.Context, cert, issuer *x509.Certificate) error {
+	key := ocspCacheKey(cert, issuer)
+
+	c.mu.Lock()
+	response, ok := c.responses[key]
+	if ok && !c.isFresh(response) {
+		delete(c.responses, key)
+		ok = false
+	}
+	if !ok {
+		response = c.stapledResponse(cert, issuer)
+	}
+	c.mu.Unlock()
+
+	if response == nil {
+		var err error
+		if response, err = c.fetch(ctx, cert, issuer); err != nil {
+			return err
+		}
+	}
+
+	c.mu.Lock()
+	if c.isFresh(response) {
+		if c.responses == nil {
+			c.responses = make(map[string]*ocsp.Response)
+		}
+		c.responses[key] = response
+	}
+	c.mu.Unlock()
+
+	return ocspStatusError(response)
+}
+
+// stapledResponse returns the fresh stapled response of cert verified with issuer, c.mu must be held
+func (c *CachingOCSPRevocationChecker) stapledResponse(cert, issuer *x509.Certificate) *ocsp.Response {
+	raw, ok := c.stapled[cert.SerialNumber.String()]
+	if !ok {
+		return nil
+	}
+	response, err := ocsp.ParseResponseForCert(raw, cert, issuer)
+	if err != nil || !c.isFresh(response) {
+		return nil
+	}
+	return response
+}
+
+// isFresh reports whether response can still be used
+func (c *CachingOCSPRevocationChecker) isFresh(response *ocsp.Response) bool {
+	now := time.Now()
+	if c.now != nil {
+		now = c.now()
+	}
+	if !response.NextUpdate.IsZero() && now.After(response.NextUpdate) {
+		return false
+	}
+	if c.MaxAge > 0 && now.After(response.ProducedAt.Add(c.MaxAge)) {
+		return false
+	}
+	// A response without next update is only fresh for MaxAge
+	return !response.NextUpdate.IsZero() || c.MaxAge > 0
+}
+
+// ocspCacheKey identifies cert by its issuer and serial number
+func ocspCacheKey(cert, issuer *x509.Certificate) string {
+	issuerHash := sha256.Sum256(issuer.RawSubjectPublicKeyInfo)
+	return fmt.Sprintf("%x:%s", issuerHash, cert.SerialNumber)
+}
+
+// CRLRevocationChecker checks certificates against CRLs that are downloaded and refreshed in the background
+// with Start, or loaded with Load on hosts without network access. A CRL is used until MaxStaleness after
+// its next update, after that certificates of its issuer fail the check until a newer CRL is available.
+type CRLRevocationChecker struct {
+	// URLs are the CRLs downloaded by Refresh
+	URLs []string
+	// HTTPClient downloads the CRLs, http.DefaultClient if nil. Start and Refresh run independently
+	// of a Client, so set it to download through ClientConfig.HTTPClient.
+	HTTPClient *http.Client
+	// RefreshInterval is how often Start refreshes the CRLs, DefaultCRLRefreshInterval if zero
+	RefreshInterval time.Duration
+	// MaxStaleness is how long a CRL is used after its next update
+	MaxStaleness time.Duration
+
+	mu    sync.RWMutex
+	lists map[string]*x509.RevocationList
+	now   func() time.Time
+}
+
+// Start refreshes the CRLs and keeps refreshing them every RefreshInterval until ctx is done
+func (c *CRLRevocationChecker) Start(ctx context.Context) error {
+	err := c.Refresh(ctx)
+
+	interval := c.RefreshInterval
+	if interval <= 0 {
+		interval = DefaultCRLRefreshInterval
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				// Failed downloads keep the previous CRL, which stays valid within MaxStaleness
+				_ = c.Refresh(ctx)
+			}
+		}
+	}()
+
+	return err
+}
+
+// Refresh downloads every CRL in URLs
+func (c *CRLRevocationChecker) Refresh(ctx context.Context) error {
+	var errs []error
+	for _, crlURL := range c.URLs {
+		raw, err := c.download(ctx, crlURL)
+		if err == nil {
+			err = c.Load(raw)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to refresh CRL %s: %w", crlURL, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Load adds a DER encoded CRL, replacing an older CRL of the same issuer.
+// Its signature is verified against the issuer when a certificate is checked.
+func (c *CRLRevocationChecker) Load(raw []byte) error {
+	list, err := x509.ParseRevocationList(raw)
+	if err != nil {
+		return fmt.Errorf("invalid CRL: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lists == nil {
+		c.lists = make(map[string]*x509.RevocationList)
+	}
+	key := string(list.RawIssuer)
+	if current, ok := c.lists[key]; ok && current.ThisUpdate.After(list.ThisUpdate) {
+		return nil
+	}
+	c.lists[key] = list
+	return nil
+}
+
+// CheckRevocation implements RevocationChecker
+func (c *CRLRevocationChecker) CheckRevocation(_ context.Context, cert, issuer *x509.Certificate) error {
+	c.mu.RLock()
+	list, ok := c.lists[string(cert.RawIssuer)]
+	c.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("no CRL for issuer %s", issuer.Subject)
+	}
+
+	if err := list.CheckSignatureFrom(issuer); err != nil {
+		return fmt.Errorf("invalid CRL signature: %w", err)
+	}
+
+	now := time.Now()
+	if c.now != nil {
+		now = c.now()
+	}
+	nextUpdate := list.NextUpdate
+	if nextUpdate.IsZero() {
+		nextUpdate = list.ThisUpdate
+	}
+	if now.After(nextUpdate.Add(c.MaxStaleness)) {
+		return fmt.Errorf("CRL of %s is stale since %s", issuer.Subject, nextUpdate.Format(time.RFC3339))
+	}
+
+	for _, entry := range list.RevokedCertificateEntries {
+		if entry.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+			return fmt.Errorf("%w at %s", ErrCertificateRevoked, entry.RevocationTime.Format(time.RFC3339))
+		}
+	}
+	return nil
+}
+
+// download fetches the DER encoded CRL at crlURL
+func (c *CRLRevocationChecker) download(ctx context.Context, crlURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, crlURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
@@ -0,0 +1,265 @@
+package appstoreserver_test
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	appstoreserver "github.com/gh73962/appleapis/appstoreserver/v1"
+	"github.com/gh73962/appleapis/appstoreserver/v1/appstoreservertest"
+	"golang.org/x/crypto/ocsp"
+)
+
+// mockResponder is a local OCSP and CRL responder for the chain of a Signer
+type mockResponder struct {
+	*httptest.Server
+	signer     *appstoreservertest.Signer
+	status     atomic.Int64
+	ocspHits   atomic.Int64
+	revoked    []*big.Int
+	nextUpdate time.Duration
+}
+
+func newMockResponder(t *testing.T) *mockResponder {
+	t.Helper()
+
+	r := mockResponder{nextUpdate: time.Hour}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/ocsp":
+			r.ocspHits.Add(1)
+			body, err := io.ReadAll(req.Body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			now := time.Now()
+			response, err := r.signer.CreateOCSPResponse(body, ocsp.Response{
+				Status:     int(r.status.Load()),
+				ThisUpdate: now.Add(-time.Minute),
+				NextUpdate: now.Add(r.nextUpdate),
+				RevokedAt:  now.Add(-time.Minute),
+			})
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			_, _ = w.Write(response)
+		case "/intermediate.crl":
+			_, _ = w.Write(r.crl(t, r.signer.IntermediateCertificate(), time.Now()))
+		case "/root.crl":
+			_, _ = w.Write(r.crl(t, rootCertificate(t, r.signer), time.Now()))
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	t.Cleanup(r.Close)
+
+	r.signer = newTestSigner(t, appstoreservertest.WithOCSPServer(r.URL+"/ocsp"))
+	return &r
+}
+
+// crl creates a CRL of issuer revoking r.revoked
+func (r *mockResponder) crl(t *testing.T, issuer *x509.Certificate, thisUpdate time.Time) []byte {
+	t.Helper()
+
+	var entries []x509.RevocationListEntry
+	for _, serial := range r.revoked {
+		entries = append(entries, x509.RevocationListEntry{SerialNumber: serial, RevocationTime: thisUpdate})
+	}
+	raw, err := r.signer.CreateRevocationList(&x509.RevocationList{
+		Number:                    big.NewInt(thisUpdate.UnixNano()),
+		ThisUpdate:                thisUpdate,
+		NextUpdate:                thisUpdate.Add(r.nextUpdate),
+		RevokedCertificateEntries: entries,
+	}, issuer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func rootCertificate(t *testing.T, signer *appstoreservertest.Signer) *x509.Certificate {
+	t.Helper()
+
+	root, err := x509.ParseCertificate(signer.RootCertificate())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+func TestOCSPRevocationChecker(t *testing.T) {
+	responder := newMockResponder(t)
+	checker := &appstoreserver.OCSPRevocationChecker{HTTPClient: responder.Client()}
+	leaf, intermediate := responder.signer.LeafCertificate(), responder.signer.IntermediateCertificate()
+
+	if err := checker.CheckRevocation(context.Background(), leaf, intermediate); err != nil {
+		t.Fatal(err)
+	}
+
+	responder.status.Store(ocsp.Revoked)
+	if err := checker.CheckRevocation(context.Background(), leaf, intermediate); !errors.Is(err, appstoreserver.ErrCertificateRevoked) {
+		t.Fatalf("expected %v, got %v", appstoreserver.ErrCertificateRevoked, err)
+	}
+
+	// A response signed by another issuer is rejected
+	if err := checker.CheckRevocation(context.Background(), leaf, rootCertificate(t, responder.signer)); err == nil {
+		t.Fatal("expected error but got nil")
+	}
+}
+
+func TestCachingOCSPRevocationChecker(t *testing.T) {
+	responder := newMockResponder(t)
+	leaf, intermediate := responder.signer.LeafCertificate(), responder.signer.IntermediateCertificate()
+	now := time.Now()
+	checker := &appstoreserver.CachingOCSPRevocationChecker{
+		OCSPRevocationChecker: appstoreserver.OCSPRevocationChecker{HTTPClient: responder.Client()},
+	}
+	checker.SetNow(func() time.Time { return now })
+
+	for range 3 {
+		if err := checker.CheckRevocation(context.Background(), leaf, intermediate); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if hits := responder.ocspHits.Load(); hits != 1 {
+		t.Fatalf("expected %d OCSP requests, got %d", 1, hits)
+	}
+
+	// The cached response expires at its next update
+	now = now.Add(2 * time.Hour)
+	responder.status.Store(ocsp.Revoked)
+	if err := checker.CheckRevocation(context.Background(), leaf, intermediate); !errors.Is(err, appstoreserver.ErrCertificateRevoked) {
+		t.Fatalf("expected %v, got %v", appstoreserver.ErrCertificateRevoked, err)
+	}
+	if hits := responder.ocspHits.Load(); hits != 2 {
+		t.Fatalf("expected %d OCSP requests, got %d", 2, hits)
+	}
+}
+
+func TestCachingOCSPRevocationCheckerStapled(t *testing.T) {
+	signer := newTestSigner(t, appstoreservertest.WithOCSPServer("http://127.0.0.1:0/ocsp"))
+	leaf, intermediate := signer.LeafCertificate(), signer.IntermediateCertificate()
+	checker := &appstoreserver.CachingOCSPRevocationChecker{}
+
+	// Without network access the check fails until a response is stapled
+	if err := checker.CheckRevocation(context.Background(), leaf, intermediate); err == nil {
+		t.Fatal("expected error but got nil")
+	}
+
+	staple := func(checker *appstoreserver.CachingOCSPRevocationChecker, signer *appstoreservertest.Signer) {
+		t.Helper()
+
+		request, err := ocsp.CreateRequest(signer.LeafCertificate(), signer.IntermediateCertificate(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response, err := signer.CreateOCSPResponse(request, ocsp.Response{Status: ocsp.Good, NextUpdate: time.Now().Add(time.Hour)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := checker.Staple(response); err != nil {
+			t.Fatal(err)
+		}
+	}
+	staple(checker, signer)
+	if err := checker.CheckRevocation(context.Background(), leaf, intermediate); err != nil {
+		t.Fatal(err)
+	}
+
+	// A stapled response is verified against the issuer of the checked certificate
+	checker = &appstoreserver.CachingOCSPRevocationChecker{}
+	staple(checker, newTestSigner(t, appstoreservertest.WithOCSPServer("http://127.0.0.1:0/ocsp")))
+	if err := checker.CheckRevocation(context.Background(), leaf, intermediate); err == nil {
+		t.Fatal("expected error but got nil")
+	}
+}
+
+func TestCRLRevocationChecker(t *testing.T) {
+	responder := newMockResponder(t)
+	leaf, intermediate := responder.signer.LeafCertificate(), responder.signer.IntermediateCertificate()
+	checker := &appstoreserver.CRLRevocationChecker{
+		URLs:       []string{responder.URL + "/intermediate.crl", responder.URL + "/root.crl"},
+		HTTPClient: responder.Client(),
+	}
+
+	if err := checker.CheckRevocation(context.Background(), leaf, intermediate); err == nil {
+		t.Fatal("expected error without CRL but got nil")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := checker.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := checker.CheckRevocation(ctx, leaf, intermediate); err != nil {
+		t.Fatal(err)
+	}
+	if err := checker.CheckRevocation(ctx, intermediate, rootCertificate(t, responder.signer)); err != nil {
+		t.Fatal(err)
+	}
+
+	responder.revoked = []*big.Int{leaf.SerialNumber}
+	if err := checker.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := checker.CheckRevocation(ctx, leaf, intermediate); !errors.Is(err, appstoreserver.ErrCertificateRevoked) {
+		t.Fatalf("expected %v, got %v", appstoreserver.ErrCertificateRevoked, err)
+	}
+
+	// A CRL signed by another issuer is rejected
+	other := newTestSigner(t)
+	if err := checker.CheckRevocation(ctx, other.LeafCertificate(), other.IntermediateCertificate()); err == nil {
+		t.Fatal("expected error but got nil")
+	}
+}
+
+func TestCRLRevocationCheckerStaleness(t *testing.T) {
+	responder := mockResponder{signer: newTestSigner(t), nextUpdate: time.Hour}
+	leaf, intermediate := responder.signer.LeafCertificate(), responder.signer.IntermediateCertificate()
+
+	// An air-gapped worker loads a CRL shipped to it
+	checker := &appstoreserver.CRLRevocationChecker{MaxStaleness: 24 * time.Hour}
+	thisUpdate := time.Now().Add(-12 * time.Hour)
+	if err := checker.Load(responder.crl(t, intermediate, thisUpdate)); err != nil {
+		t.Fatal(err)
+	}
+	if err := checker.CheckRevocation(context.Background(), leaf, intermediate); err != nil {
+		t.Fatal(err)
+	}
+
+	// An older CRL doesn't replace the loaded one
+	if err := checker.Load(responder.crl(t, intermediate, thisUpdate.Add(-48*time.Hour))); err != nil {
+		t.Fatal(err)
+	}
+	if err := checker.CheckRevocation(context.Background(), leaf, intermediate); err != nil {
+		t.Fatal(err)
+	}
+
+	checker.SetNow(func() time.Time { return thisUpdate.Add(26 * time.Hour) })
+	if err := checker.CheckRevocation(context.Background(), leaf, intermediate); err == nil {
+		t.Fatal("expected stale CRL error but got nil")
+	}
+}
+
+func TestRevocationCheckerInChainVerification(t *testing.T) {
+	signer := newTestSigner(t)
+	signedTransaction := signTestTransaction(t, signer, "1", time.Now())
+
+	verifier := newTestVerifier(t, signer, appstoreserver.ClientConfig{RevocationChecker: appstoreserver.NoopRevocationChecker{}})
+	if _, err := verifier.VerifyAndDecodeSignedTransaction(signedTransaction); err != nil {
+		t.Fatal(err)
+	}
+
+	verifier = newTestVerifier(t, signer, appstoreserver.ClientConfig{RevocationChecker: &appstoreserver.CRLRevocationChecker{}})
+	_, err := verifier.VerifyAndDecodeSignedTransaction(signedTransaction)
+	expectVerificationFailure(t, err)
+}
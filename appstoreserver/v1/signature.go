@@ -0,0 +1,216 @@
+package appstoreserver
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// promotionalOfferSeparator is the invisible separator used between fields of the legacy promotional offer payload
+	promotionalOfferSeparator = "\u2063"
+
+	// AudiencePromotionalOffer is the audience of promotional offer V2 signatures
+	AudiencePromotionalOffer = "promotional-offer"
+	// AudienceIntroductoryOfferEligibility is the audience of introductory offer eligibility signatures
+	AudienceIntroductoryOfferEligibility = "introductory-offer-eligibility"
+	// AudienceAdvancedCommerceAPI is the audience of Advanced Commerce API in-app request signatures
+	AudienceAdvancedCommerceAPI = "advanced-commerce-api"
+)
+
+// jwsSignatureCreator signs feature specific claims as a compact JWS
+type jwsSignatureCreator struct {
+	audience   string
+	signingKey *ecdsa.PrivateKey
+	keyID      string
+	issuerID   string
+	bundleID   string
+}
+
+// newJWSSignatureCreator creates a jwsSignatureCreator sharing the key of the token generator
+func newJWSSignatureCreator(audience string, tokenGenerator *TokenGenerator) *jwsSignatureCreator {
+	return &jwsSignatureCreator{
+		audience:   audience,
+		signingKey: tokenGenerator.signingKey,
+		keyID:      tokenGenerator.keyID,
+		issuerID:   tokenGenerator.issuerID,
+		bundleID:   tokenGenerator.bundleID,
+	}
+}
+
+// createSignature adds the common claims to the feature specific claims and signs them with ES256
+func (s *jwsSignatureCreator) createSignature(claims jwt.MapClaims) (string, error) {
+	nonce, err := newUUID()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	claims["bid"] = s.bundleID
+	claims["iss"] = s.issuerID
+	claims["aud"] = s.audience
+	claims["iat"] = time.Now().Unix()
+	claims["nonce"] = nonce
+
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["kid"] = s.keyID
+
+	signature, err := token.SignedString(s.signingKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign JWS: %w", err)
+	}
+
+	return signature, nil
+}
+
+// PromotionalOfferSignatureCreator creates signatures for subscription promotional offers
+// See https://developer.apple.com/documentation/storekit/in-app_purchase/original_api_for_in-app_purchase/subscriptions_and_offers/generating_a_signature_for_promotional_offers
+type PromotionalOfferSignatureCreator struct {
+	signingKey *ecdsa.PrivateKey
+	keyID      string
+	bundleID   string
+	jws        *jwsSignatureCreator
+}
+
+// NewPromotionalOfferSignatureCreator creates a new PromotionalOfferSignatureCreator sharing the key of the token generator
+func NewPromotionalOfferSignatureCreator(tokenGenerator *TokenGenerator) *PromotionalOfferSignatureCreator {
+	return &PromotionalOfferSignatureCreator{
+		signingKey: tokenGenerator.signingKey,
+		keyID:      tokenGenerator.keyID,
+		bundleID:   tokenGenerator.bundleID,
+		jws:        newJWSSignatureCreator(AudiencePromotionalOffer, tokenGenerator),
+	}
+}
+
+// CreateSignature returns the base64 encoded legacy promotional offer signature.
+// appAccountToken may be empty, nonce is a UUID and timestamp is the UNIX time in milliseconds.
+func (p *PromotionalOfferSignatureCreator) CreateSignature(productID, offerIdentifier, appAccountToken, nonce string, timestamp int64) (string, error) {
+	payload := strings.Join([]string{
+		p.bundleID,
+		p.keyID,
+		productID,
+		offerIdentifier,
+		strings.ToLower(appAccountToken),
+		strings.ToLower(nonce),
+		strconv.FormatInt(timestamp, 10),
+	}, promotionalOfferSeparator)
+
+	digest := sha256.Sum256([]byte(payload))
+	signature, err := ecdsa.SignASN1(rand.Reader, p.signingKey, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign promotional offer: %w", err)
+	}
+
+	return base64.StdEncoding.EncodeToString(signature), nil
+}
+
+// CreateV2Signature returns the JWS promotional offer V2 signature. transactionID is optional.
+// See https://developer.apple.com/documentation/storekit/generating-jws-to-sign-app-store-requests
+func (p *PromotionalOfferSignatureCreator) CreateV2Signature(productID, offerIdentifier, transactionID string) (string, error) {
+	if productID == "" {
+		return "", fmt.Errorf("productID is required")
+	}
+	if offerIdentifier == "" {
+		return "", fmt.Errorf("offerIdentifier is required")
+	}
+
+	claims := jwt.MapClaims{
+		"productId":       productID,
+		"offerIdentifier": offerIdentifier,
+	}
+	if transactionID != "" {
+		claims["transactionId"] = transactionID
+	}
+
+	return p.jws.createSignature(claims)
+}
+
+// IntroductoryOfferEligibilitySignatureCreator creates signatures that override a customer's introductory offer eligibility
+// See https://developer.apple.com/documentation/storekit/product/purchaseoption/introductoryoffereligibility(compactjws:)
+type IntroductoryOfferEligibilitySignatureCreator struct {
+	jws *jwsSignatureCreator
+}
+
+// NewIntroductoryOfferEligibilitySignatureCreator creates a new IntroductoryOfferEligibilitySignatureCreator sharing the key of the token generator
+func NewIntroductoryOfferEligibilitySignatureCreator(tokenGenerator *TokenGenerator) *IntroductoryOfferEligibilitySignatureCreator {
+	return &IntroductoryOfferEligibilitySignatureCreator{
+		jws: newJWSSignatureCreator(AudienceIntroductoryOfferEligibility, tokenGenerator),
+	}
+}
+
+// CreateSignature returns the JWS that sets whether the customer may redeem the introductory offer of productID
+func (i *IntroductoryOfferEligibilitySignatureCreator) CreateSignature(productID string, allowIntroductoryOffer bool, transactionID string) (string, error) {
+	if productID == "" {
+		return "", fmt.Errorf("productID is required")
+	}
+	if transactionID == "" {
+		return "", fmt.Errorf("transactionID is required")
+	}
+
+	return i.jws.createSignature(jwt.MapClaims{
+		"productId":              productID,
+		"allowIntroductoryOffer": allowIntroductoryOffer,
+		"transactionId":          transactionID,
+	})
+}
+
+// AdvancedCommerceInAppSignatureCreator creates signatures for Advanced Commerce API in-app requests
+// See https://developer.apple.com/documentation/advancedcommerceapi/sending-advanced-commerce-api-requests-from-your-app
+type AdvancedCommerceInAppSignatureCreator struct {
+	jws *jwsSignatureCreator
+}
+
+// NewAdvancedCommerceInAppSignatureCreator creates a new AdvancedCommerceInAppSignatureCreator sharing the key of the token generator
+func NewAdvancedCommerceInAppSignatureCreator(tokenGenerator *TokenGenerator) *AdvancedCommerceInAppSignatureCreator {
+	return &AdvancedCommerceInAppSignatureCreator{
+		jws: newJWSSignatureCreator(AudienceAdvancedCommerceAPI, tokenGenerator),
+	}
+}
+
+// CreateSignature returns the JWS carrying the JSON encoded request as a base64 request claim
+func (a *AdvancedCommerceInAppSignatureCreator) CreateSignature(request any) (string, error) {
+	if isNil(request) {
+		return "", fmt.Errorf("request is required")
+	}
+
+	requestBytes, err := json.Marshal(request)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	return a.jws.createSignature(jwt.MapClaims{
+		"request": base64.StdEncoding.EncodeToString(requestBytes),
+	})
+}
+
+// isNil reports whether v is nil or a typed nil, which would be encoded as a null request
+func isNil(v any) bool {
+	if v == nil {
+		return true
+	}
+	switch rv := reflect.ValueOf(v); rv.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Slice:
+		return rv.IsNil()
+	default:
+		return false
+	}
+}
+
+// newUUID returns a random version 4 UUID
+func newUUID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
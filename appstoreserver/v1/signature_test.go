@@ -0,0 +1,180 @@
+package appstoreserver
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func parseTestSignature(t *testing.T, client *Client, signature string) (*jwt.Token, jwt.MapClaims) {
+	t.Helper()
+
+	claims := jwt.MapClaims{}
+	token, err := jwt.ParseWithClaims(signature, claims, func(token *jwt.Token) (any, error) {
+		return &client.TokenGenerator.signingKey.PublicKey, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodES256.Alg()}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token, claims
+}
+
+func assertCommonSignatureClaims(t *testing.T, token *jwt.Token, claims jwt.MapClaims, audience string) {
+	t.Helper()
+
+	if token.Header["kid"] != "keyId" {
+		t.Fatalf("expected %q, got %v", "keyId", token.Header["kid"])
+	}
+	if claims["aud"] != audience {
+		t.Fatalf("expected %q, got %v", audience, claims["aud"])
+	}
+	if claims["iss"] != "issuerId" {
+		t.Fatalf("expected %q, got %v", "issuerId", claims["iss"])
+	}
+	if claims["bid"] != "com.example" {
+		t.Fatalf("expected %q, got %v", "com.example", claims["bid"])
+	}
+	if _, ok := claims["iat"].(float64); !ok {
+		t.Fatalf("expected numeric iat, got %v", claims["iat"])
+	}
+	if nonce, ok := claims["nonce"].(string); !ok || len(nonce) != 36 {
+		t.Fatalf("expected UUID nonce, got %v", claims["nonce"])
+	}
+}
+
+func TestPromotionalOfferSignature(t *testing.T) {
+	client, err := mockTestClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	creator := NewPromotionalOfferSignatureCreator(client.TokenGenerator)
+	signature, err := creator.CreateSignature("productId", "offerId", "7389A31A-FB6D-4569-A2A6-DB7D85D84813", "20FBA8A7-76E8-4CB9-9B17-0F4A8E2A2C50", 1698148900000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload := "com.example\u2063keyId\u2063productId\u2063offerId\u20637389a31a-fb6d-4569-a2a6-db7d85d84813\u206320fba8a7-76e8-4cb9-9b17-0f4a8e2a2c50\u20631698148900000"
+	digest := sha256.Sum256([]byte(payload))
+	if !ecdsa.VerifyASN1(&client.TokenGenerator.signingKey.PublicKey, digest[:], decoded) {
+		t.Fatal("expected signature to verify")
+	}
+}
+
+func TestPromotionalOfferV2Signature(t *testing.T) {
+	client, err := mockTestClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	creator := NewPromotionalOfferSignatureCreator(client.TokenGenerator)
+	signature, err := creator.CreateV2Signature("productId", "offerId", "transactionId")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, claims := parseTestSignature(t, client, signature)
+	assertCommonSignatureClaims(t, token, claims, AudiencePromotionalOffer)
+	if claims["productId"] != "productId" {
+		t.Fatalf("expected %q, got %v", "productId", claims["productId"])
+	}
+	if claims["offerIdentifier"] != "offerId" {
+		t.Fatalf("expected %q, got %v", "offerId", claims["offerIdentifier"])
+	}
+	if claims["transactionId"] != "transactionId" {
+		t.Fatalf("expected %q, got %v", "transactionId", claims["transactionId"])
+	}
+}
+
+func TestPromotionalOfferV2SignatureWithoutTransactionID(t *testing.T) {
+	client, err := mockTestClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	creator := NewPromotionalOfferSignatureCreator(client.TokenGenerator)
+	signature, err := creator.CreateV2Signature("productId", "offerId", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, claims := parseTestSignature(t, client, signature)
+	if _, ok := claims["transactionId"]; ok {
+		t.Fatalf("expected no transactionId, got %v", claims["transactionId"])
+	}
+
+	if _, err := creator.CreateV2Signature("", "offerId", ""); err == nil {
+		t.Fatal("expected error but got nil")
+	}
+}
+
+func TestIntroductoryOfferEligibilitySignature(t *testing.T) {
+	client, err := mockTestClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	creator := NewIntroductoryOfferEligibilitySignatureCreator(client.TokenGenerator)
+	signature, err := creator.CreateSignature("productId", true, "transactionId")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, claims := parseTestSignature(t, client, signature)
+	assertCommonSignatureClaims(t, token, claims, AudienceIntroductoryOfferEligibility)
+	if claims["productId"] != "productId" {
+		t.Fatalf("expected %q, got %v", "productId", claims["productId"])
+	}
+	if claims["allowIntroductoryOffer"] != true {
+		t.Fatalf("expected %v, got %v", true, claims["allowIntroductoryOffer"])
+	}
+	if claims["transactionId"] != "transactionId" {
+		t.Fatalf("expected %q, got %v", "transactionId", claims["transactionId"])
+	}
+}
+
+func TestAdvancedCommerceInAppSignature(t *testing.T) {
+	client, err := mockTestClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type testInAppRequest struct {
+		TestValue string `json:"testValue"`
+	}
+
+	creator := NewAdvancedCommerceInAppSignatureCreator(client.TokenGenerator)
+	signature, err := creator.CreateSignature(&testInAppRequest{TestValue: "testValue"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, claims := parseTestSignature(t, client, signature)
+	assertCommonSignatureClaims(t, token, claims, AudienceAdvancedCommerceAPI)
+
+	encodedRequest, ok := claims["request"].(string)
+	if !ok {
+		t.Fatalf("expected string request, got %v", claims["request"])
+	}
+	request, err := base64.StdEncoding.DecodeString(encodedRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(request) != `{"testValue":"testValue"}` {
+		t.Fatalf("expected %q, got %q", `{"testValue":"testValue"}`, string(request))
+	}
+
+	for _, request := range []any{nil, (*testInAppRequest)(nil), map[string]string(nil)} {
+		if _, err := creator.CreateSignature(request); err == nil {
+			t.Fatalf("expected error for %#v but got nil", request)
+		}
+	}
+}
@@ -25,6 +25,10 @@ func mockSignedData(filePath string) (string, error) {
 		return "", err
 	}
 
+	return mockSignedPayload(payload)
+}
+
+func mockSignedPayload(payload map[string]interface{}) (string, error) {
 	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
 	if err != nil {
 		return "", err
@@ -40,6 +44,26 @@ func mockSignedData(filePath string) (string, error) {
 	return signedToken, nil
 }
 
+func mockSignedNotification(filePath string, data map[string]interface{}) (string, error) {
+	raw, err := os.ReadFile(filepath.Join("../../testdata/", filePath))
+	if err != nil {
+		return "", err
+	}
+
+	var payload map[string]interface{}
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		return "", err
+	}
+
+	if payloadData, ok := payload["data"].(map[string]interface{}); ok {
+		for k, v := range data {
+			payloadData[k] = v
+		}
+	}
+
+	return mockSignedPayload(payload)
+}
+
 func mockTestClient(opts ...Option) (*Client, error) {
 	pk, err := os.ReadFile("../../testdata/certs/testSigningKey.p8")
 	if err != nil {
@@ -108,3 +132,34 @@ func mockClientWithBody(filePath string, statusCode int, opts ...Option) (*Clien
 	opts = append(opts, WithHTTPClient(httpClient))
 	return mockTestClient(opts...)
 }
+
+func mockClientWithHandler(handler func(req *http.Request) (*http.Response, error), opts ...Option) (*Client, error) {
+	httpClient := &http.Client{
+		Transport: &mockTransport{RoundTripFunc: handler},
+	}
+
+	opts = append(opts, WithHTTPClient(httpClient))
+	return mockTestClient(opts...)
+}
+
+func mockResponse(statusCode int, header http.Header, filePath string) (*http.Response, error) {
+	var responseBody []byte
+	if filePath != "" {
+		var err error
+		responseBody, err = os.ReadFile(filepath.Join("../../testdata/", filePath))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if header == nil {
+		header = make(http.Header)
+	}
+	header.Set("Content-Type", "application/json")
+
+	return &http.Response{
+		StatusCode: statusCode,
+		Header:     header,
+		Body:       io.NopCloser(bytes.NewBuffer(responseBody)),
+	}, nil
+}
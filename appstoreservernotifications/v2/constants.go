@@ -73,6 +73,20 @@ const (
 	TypeTest NotificationType = "TEST"
 )
 
+// IsKnown reports whether t is one of the notification types defined in this package
+func (t NotificationType) IsKnown() bool {
+	switch t {
+	case TypeConsumptionRequest, TypeDidChangeRenewalPref, TypeDidChangeRenewalStatus, TypeDidFailToRenew,
+		TypeDidRenew, TypeExpired, TypeExternalPurchaseToken, TypeGracePeriodExpired, TypeMetadataUpdate,
+		TypeMigration, TypeOfferRedeemed, TypeOneTimeCharge, TypePriceChange, TypePriceIncrease, TypeRefund,
+		TypeRefundDeclined, TypeRefundReversed, TypeRenewalExtended, TypeRenewalExtension, TypeRevoke,
+		TypeSubscribed, TypeTest:
+		return true
+	default:
+		return false
+	}
+}
+
 // Subtype represents the subtype of App Store Server Notification v2
 // See https://developer.apple.com/documentation/appstoreservernotifications/subtype
 type Subtype string
@@ -0,0 +1,299 @@
+package appstoreservernotifications
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ProcessingStatus represents the outcome of processing a notification
+type ProcessingStatus string
+
+const (
+	// ProcessingStatusSucceeded indicates the notification was processed successfully
+	ProcessingStatusSucceeded ProcessingStatus = "SUCCEEDED"
+
+	// ProcessingStatusFailed indicates processing the notification failed and it may be processed again
+	ProcessingStatusFailed ProcessingStatus = "FAILED"
+
+	// ProcessingStatusInProgress indicates the notification was claimed and is being processed
+	ProcessingStatusInProgress ProcessingStatus = "IN_PROGRESS"
+)
+
+// DefaultClaimTimeout is how long a claim stays in progress before another delivery may take it over,
+// so a notification claimed by a crashed process is eventually processed
+const DefaultClaimTimeout = 5 * time.Minute
+
+// ProcessingRecord records how a notification identified by its NotificationUUID was processed
+type ProcessingRecord struct {
+	NotificationUUID string           `json:"notificationUUID"`
+	NotificationType NotificationType `json:"notificationType,omitempty"`
+	Subtype          Subtype          `json:"subtype,omitempty"`
+	SignedDate       int64            `json:"signedDate,omitempty"`
+	Status           ProcessingStatus `json:"status"`
+	Error            string           `json:"error,omitempty"`
+	Attempts         int              `json:"attempts"`
+	FirstAttemptDate time.Time        `json:"firstAttemptDate"`
+	LastAttemptDate  time.Time        `json:"lastAttemptDate"`
+	ProcessedDate    time.Time        `json:"processedDate,omitzero"`
+}
+
+// NewProcessingRecord creates a ProcessingRecord for payload without any attempts
+func NewProcessingRecord(payload *DecodedPayload) *ProcessingRecord {
+	return &ProcessingRecord{
+		NotificationUUID: payload.NotificationUUID,
+		NotificationType: payload.NotificationType,
+		Subtype:          payload.Subtype,
+		SignedDate:       payload.SignedDate,
+	}
+}
+
+// IsProcessed returns true if the notification was processed successfully
+func (r *ProcessingRecord) IsProcessed() bool {
+	return r != nil && r.Status == ProcessingStatusSucceeded
+}
+
+// IdempotencyStore stores ProcessingRecords keyed by DecodedPayload.NotificationUUID so that
+// notifications retried by the App Store or replayed from the notification history are processed once
+type IdempotencyStore interface {
+	// Get returns the record of notificationUUID, or nil if there is none
+	Get(ctx context.Context, notificationUUID string) (*ProcessingRecord, error)
+
+	// Put creates or replaces the record of record.NotificationUUID
+	Put(ctx context.Context, record *ProcessingRecord) error
+
+	// Claim atomically stores record as ProcessingStatusInProgress, counting an attempt, unless the
+	// notification was processed or claimed less than the claim timeout of the store ago. It returns the stored record
+	// and whether the caller claimed it, so concurrent deliveries of a notification are handled once.
+	Claim(ctx context.Context, record *ProcessingRecord) (*ProcessingRecord, bool, error)
+}
+
+// IdempotencyStoreOption configures MemoryIdempotencyStore and FileIdempotencyStore
+type IdempotencyStoreOption func(*recordSet)
+
+// WithClaimTimeout sets how long a claim stays in progress, defaults to DefaultClaimTimeout.
+// It should exceed the time taken to handle a notification.
+func WithClaimTimeout(timeout time.Duration) IdempotencyStoreOption {
+	return func(s *recordSet) {
+		s.claimTimeout = timeout
+	}
+}
+
+// recordSet is a set of ProcessingRecords expiring ttl after they were last written
+type recordSet struct {
+	records      map[string]storedRecord
+	ttl          time.Duration
+	claimTimeout time.Duration
+	now          func() time.Time
+	nextPrune    time.Time
+}
+
+type storedRecord struct {
+	Record    ProcessingRecord `json:"record"`
+	ExpiresAt time.Time        `json:"expiresAt,omitzero"`
+}
+
+func newRecordSet(ttl time.Duration, options []IdempotencyStoreOption) recordSet {
+	s := recordSet{
+		records:      make(map[string]storedRecord),
+		ttl:          ttl,
+		claimTimeout: DefaultClaimTimeout,
+		now:          time.Now,
+	}
+	for _, option := range options {
+		option(&s)
+	}
+	return s
+}
+
+func (s *recordSet) get(notificationUUID string) *ProcessingRecord {
+	stored, ok := s.records[notificationUUID]
+	if !ok {
+		return nil
+	}
+	if !stored.ExpiresAt.IsZero() && !s.now().Before(stored.ExpiresAt) {
+		delete(s.records, notificationUUID)
+		return nil
+	}
+	record := stored.Record
+	return &record
+}
+
+func (s *recordSet) put(record *ProcessingRecord) {
+	now := s.now()
+	stored := storedRecord{Record: *record}
+	if s.ttl > 0 {
+		stored.ExpiresAt = now.Add(s.ttl)
+	}
+	s.records[record.NotificationUUID] = stored
+	s.prune(now)
+}
+
+// claim implements IdempotencyStore.Claim, the caller must hold the lock of the store
+func (s *recordSet) claim(record *ProcessingRecord) (*ProcessingRecord, bool) {
+	now := s.now()
+	existing := s.get(record.NotificationUUID)
+	if existing.IsProcessed() {
+		return existing, false
+	}
+	if existing != nil && existing.Status == ProcessingStatusInProgress && now.Sub(existing.LastAttemptDate) < s.claimTimeout {
+		return existing, false
+	}
+
+	claimed := *record
+	if existing != nil {
+		claimed.Attempts = existing.Attempts
+		claimed.FirstAttemptDate = existing.FirstAttemptDate
+	}
+	if claimed.FirstAttemptDate.IsZero() {
+		claimed.FirstAttemptDate = now
+	}
+	claimed.Attempts++
+	claimed.LastAttemptDate = now
+	claimed.Status = ProcessingStatusInProgress
+	claimed.Error = ""
+	s.put(&claimed)
+	return &claimed, true
+}
+
+// prune removes expired records, at most once per half ttl.
+// Records without an expiry, e.g. loaded from a file written without ttl, are kept.
+func (s *recordSet) prune(now time.Time) {
+	if s.ttl <= 0 || now.Before(s.nextPrune) {
+		return
+	}
+	for key, stored := range s.records {
+		if !stored.ExpiresAt.IsZero() && !now.Before(stored.ExpiresAt) {
+			delete(s.records, key)
+		}
+	}
+	s.nextPrune = now.Add(s.ttl / 2)
+}
+
+// MemoryIdempotencyStore is an in-memory IdempotencyStore whose records expire after a TTL
+type MemoryIdempotencyStore struct {
+	mu  sync.Mutex
+	set recordSet
+}
+
+// NewMemoryIdempotencyStore creates a new MemoryIdempotencyStore, records never expire if ttl is not positive
+func NewMemoryIdempotencyStore(ttl time.Duration, options ...IdempotencyStoreOption) *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{set: newRecordSet(ttl, options)}
+}
+
+// Get implements IdempotencyStore
+func (s *MemoryIdempotencyStore) Get(ctx context.Context, notificationUUID string) (*ProcessingRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.set.get(notificationUUID), nil
+}
+
+// Put implements IdempotencyStore
+func (s *MemoryIdempotencyStore) Put(ctx context.Context, record *ProcessingRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.set.put(record)
+	return nil
+}
+
+// Claim implements IdempotencyStore
+func (s *MemoryIdempotencyStore) Claim(ctx context.Context, record *ProcessingRecord) (*ProcessingRecord, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	claimed, ok := s.set.claim(record)
+	return claimed, ok, nil
+}
+
+// FileIdempotencyStore is an IdempotencyStore persisting its records to a JSON file.
+// The whole file is rewritten on every Put, so it suits single process deployments with moderate traffic.
+type FileIdempotencyStore struct {
+	mu   sync.Mutex
+	path string
+	set  recordSet
+}
+
+// NewFileIdempotencyStore creates a new FileIdempotencyStore loading existing records from path,
+// records never expire if ttl is not positive
+func NewFileIdempotencyStore(path string, ttl time.Duration, options ...IdempotencyStoreOption) (*FileIdempotencyStore, error) {
+	s := FileIdempotencyStore{
+		path: path,
+		set:  newRecordSet(ttl, options),
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read idempotency store: %w", err)
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &s.set.records); err != nil {
+			return nil, fmt.Errorf("failed to parse idempotency store: %w", err)
+		}
+	}
+	return &s, nil
+}
+
+// Get implements IdempotencyStore
+func (s *FileIdempotencyStore) Get(ctx context.Context, notificationUUID string) (*ProcessingRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.set.get(notificationUUID), nil
+}
+
+// Put implements IdempotencyStore
+func (s *FileIdempotencyStore) Put(ctx context.Context, record *ProcessingRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.set.put(record)
+	return s.save()
+}
+
+// Claim implements IdempotencyStore
+func (s *FileIdempotencyStore) Claim(ctx context.Context, record *ProcessingRecord) (*ProcessingRecord, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	claimed, ok := s.set.claim(record)
+	if !ok {
+		return claimed, false, nil
+	}
+	if err := s.save(); err != nil {
+		return nil, false, err
+	}
+	return claimed, true, nil
+}
+
+// save atomically replaces the file with the current records
+func (s *FileIdempotencyStore) save() error {
+	data, err := json.Marshal(s.set.records)
+	if err != nil {
+		return fmt.Errorf("failed to encode idempotency store: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write idempotency store: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write idempotency store: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write idempotency store: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to write idempotency store: %w", err)
+	}
+	return nil
+}
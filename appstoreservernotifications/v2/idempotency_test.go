@@ -0,0 +1,204 @@
+package appstoreservernotifications
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMemoryIdempotencyStore(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	store := NewMemoryIdempotencyStore(time.Hour)
+	store.set.now = func() time.Time { return now }
+
+	record, err := store.Get(ctx, "uuid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record != nil {
+		t.Fatalf("expected nil, got %+v", record)
+	}
+
+	record = NewProcessingRecord(&DecodedPayload{NotificationUUID: "uuid", NotificationType: TypeRefund})
+	record.Status = ProcessingStatusSucceeded
+	if err := store.Put(ctx, record); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := store.Get(ctx, "uuid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.IsProcessed() || got.NotificationType != TypeRefund {
+		t.Fatalf("expected processed REFUND record, got %+v", got)
+	}
+
+	now = now.Add(time.Hour)
+	got, err = store.Get(ctx, "uuid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != nil {
+		t.Fatalf("expected expired record, got %+v", got)
+	}
+}
+
+func TestMemoryIdempotencyStorePrune(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	store := NewMemoryIdempotencyStore(time.Minute)
+	store.set.now = func() time.Time { return now }
+
+	if err := store.Put(ctx, &ProcessingRecord{NotificationUUID: "first"}); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(2 * time.Minute)
+	if err := store.Put(ctx, &ProcessingRecord{NotificationUUID: "second"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(store.set.records) != 1 {
+		t.Fatalf("expected %d records, got %d", 1, len(store.set.records))
+	}
+}
+
+func TestFileIdempotencyStorePruneWithoutExpiry(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "notifications.json")
+
+	store, err := NewFileIdempotencyStore(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put(ctx, &ProcessingRecord{NotificationUUID: "first"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Records written without ttl never expire when the file is reopened with a ttl
+	reopened, err := NewFileIdempotencyStore(path, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := reopened.Put(ctx, &ProcessingRecord{NotificationUUID: "second"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := reopened.Get(ctx, "first"); got == nil {
+		t.Fatal("expected record without expiry to be kept")
+	}
+}
+
+func TestFileIdempotencyStore(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "notifications.json")
+
+	store, err := NewFileIdempotencyStore(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	processedDate := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := store.Put(ctx, &ProcessingRecord{
+		NotificationUUID: "uuid",
+		Status:           ProcessingStatusFailed,
+		Error:            "failed",
+		Attempts:         2,
+		ProcessedDate:    processedDate,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := NewFileIdempotencyStore(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := reopened.Get(ctx, "uuid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == nil {
+		t.Fatal("expected record, got nil")
+	}
+	if got.IsProcessed() {
+		t.Fatal("expected failed record not to be processed")
+	}
+	if got.Attempts != 2 || got.Error != "failed" || !got.ProcessedDate.Equal(processedDate) {
+		t.Fatalf("expected persisted record, got %+v", got)
+	}
+}
+
+func TestIdempotencyStoreClaim(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	memory := NewMemoryIdempotencyStore(time.Hour, WithClaimTimeout(time.Minute))
+	memory.set.now = func() time.Time { return now }
+	file, err := NewFileIdempotencyStore(filepath.Join(t.TempDir(), "notifications.json"), time.Hour, WithClaimTimeout(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.set.now = func() time.Time { return now }
+
+	for _, store := range []IdempotencyStore{memory, file} {
+		payload := &DecodedPayload{NotificationUUID: "uuid", NotificationType: TypeRefund}
+		record, claimed, err := store.Claim(ctx, NewProcessingRecord(payload))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !claimed || record.Status != ProcessingStatusInProgress || record.Attempts != 1 {
+			t.Fatalf("expected claimed record, got %v %+v", claimed, record)
+		}
+
+		// Another delivery can't claim the notification until the claim times out
+		if _, claimed, _ := store.Claim(ctx, NewProcessingRecord(payload)); claimed {
+			t.Fatal("expected claim in progress")
+		}
+		now = now.Add(time.Minute)
+		if record, claimed, _ = store.Claim(ctx, NewProcessingRecord(payload)); !claimed || record.Attempts != 2 {
+			t.Fatalf("expected stale claim to be taken over, got %v %+v", claimed, record)
+		}
+
+		// A failed notification can be claimed again, a processed one can't
+		record.Status = ProcessingStatusFailed
+		if err := store.Put(ctx, record); err != nil {
+			t.Fatal(err)
+		}
+		if record, claimed, _ = store.Claim(ctx, NewProcessingRecord(payload)); !claimed || record.Attempts != 3 || record.FirstAttemptDate.Equal(record.LastAttemptDate) {
+			t.Fatalf("expected failed record to be claimed, got %v %+v", claimed, record)
+		}
+		record.Status = ProcessingStatusSucceeded
+		if err := store.Put(ctx, record); err != nil {
+			t.Fatal(err)
+		}
+		if record, claimed, _ = store.Claim(ctx, NewProcessingRecord(payload)); claimed || !record.IsProcessed() {
+			t.Fatalf("expected processed record, got %v %+v", claimed, record)
+		}
+	}
+}
+
+func TestIdempotencyStoreConcurrentClaim(t *testing.T) {
+	store := NewMemoryIdempotencyStore(time.Hour)
+	var (
+		wg      sync.WaitGroup
+		claimed atomic.Int64
+	)
+	for range 16 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, ok, err := store.Claim(context.Background(), &ProcessingRecord{NotificationUUID: "uuid"})
+			if err != nil {
+				t.Error(err)
+			}
+			if ok {
+				claimed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if claimed := claimed.Load(); claimed != 1 {
+		t.Fatalf("expected %d claim, got %d", 1, claimed)
+	}
+}
@@ -0,0 +1,185 @@
+package appstoreservernotifications
+
+import "context"
+
+// HandlerFunc handles a decoded notification together with its decoded transaction and renewal info.
+// T and R are the decoded signedTransactionInfo and signedRenewalInfo types, zero when absent.
+type HandlerFunc[T, R any] func(ctx context.Context, payload *DecodedPayload, transaction T, renewalInfo R) error
+
+type routeKey struct {
+	notificationType NotificationType
+	subtype          Subtype
+}
+
+// Router dispatches notifications to handlers registered by NotificationType and Subtype.
+// A handler registered with an empty Subtype receives every subtype of its type without a more specific handler.
+// Notifications without a matching handler go to the fallback handler, and notifications with a type
+// unknown to this package go to the unknown type handler, or to the fallback handler if there is none.
+// Handlers must be registered before Dispatch is called concurrently.
+type Router[T, R any] struct {
+	routes   map[routeKey]HandlerFunc[T, R]
+	fallback HandlerFunc[T, R]
+	unknown  HandlerFunc[T, R]
+}
+
+// NewRouter creates a new Router
+func NewRouter[T, R any]() *Router[T, R] {
+	return &Router[T, R]{routes: make(map[routeKey]HandlerFunc[T, R])}
+}
+
+// On registers fn for notificationType and subtype, an empty subtype matches any subtype
+func (r *Router[T, R]) On(notificationType NotificationType, subtype Subtype, fn HandlerFunc[T, R]) *Router[T, R] {
+	r.routes[routeKey{notificationType: notificationType, subtype: subtype}] = fn
+	return r
+}
+
+// OnFallback registers fn for notifications without a matching handler
+func (r *Router[T, R]) OnFallback(fn HandlerFunc[T, R]) *Router[T, R] {
+	r.fallback = fn
+	return r
+}
+
+// OnUnknownType registers fn for notifications with a NotificationType unknown to this package
+func (r *Router[T, R]) OnUnknownType(fn HandlerFunc[T, R]) *Router[T, R] {
+	r.unknown = fn
+	return r
+}
+
+// OnConsumptionRequest registers fn for CONSUMPTION_REQUEST notifications
+func (r *Router[T, R]) OnConsumptionRequest(fn HandlerFunc[T, R]) *Router[T, R] {
+	return r.On(TypeConsumptionRequest, "", fn)
+}
+
+// OnDidChangeRenewalPref registers fn for DID_CHANGE_RENEWAL_PREF notifications with subtype
+func (r *Router[T, R]) OnDidChangeRenewalPref(subtype Subtype, fn HandlerFunc[T, R]) *Router[T, R] {
+	return r.On(TypeDidChangeRenewalPref, subtype, fn)
+}
+
+// OnDidChangeRenewalStatus registers fn for DID_CHANGE_RENEWAL_STATUS notifications with subtype
+func (r *Router[T, R]) OnDidChangeRenewalStatus(subtype Subtype, fn HandlerFunc[T, R]) *Router[T, R] {
+	return r.On(TypeDidChangeRenewalStatus, subtype, fn)
+}
+
+// OnDidFailToRenew registers fn for DID_FAIL_TO_RENEW notifications with subtype
+func (r *Router[T, R]) OnDidFailToRenew(subtype Subtype, fn HandlerFunc[T, R]) *Router[T, R] {
+	return r.On(TypeDidFailToRenew, subtype, fn)
+}
+
+// OnDidRenew registers fn for DID_RENEW notifications with subtype
+func (r *Router[T, R]) OnDidRenew(subtype Subtype, fn HandlerFunc[T, R]) *Router[T, R] {
+	return r.On(TypeDidRenew, subtype, fn)
+}
+
+// OnExpired registers fn for EXPIRED notifications with subtype
+func (r *Router[T, R]) OnExpired(subtype Subtype, fn HandlerFunc[T, R]) *Router[T, R] {
+	return r.On(TypeExpired, subtype, fn)
+}
+
+// OnExternalPurchaseToken registers fn for EXTERNAL_PURCHASE_TOKEN notifications of any subtype
+func (r *Router[T, R]) OnExternalPurchaseToken(fn HandlerFunc[T, R]) *Router[T, R] {
+	return r.On(TypeExternalPurchaseToken, "", fn)
+}
+
+// OnGracePeriodExpired registers fn for GRACE_PERIOD_EXPIRED notifications
+func (r *Router[T, R]) OnGracePeriodExpired(fn HandlerFunc[T, R]) *Router[T, R] {
+	return r.On(TypeGracePeriodExpired, "", fn)
+}
+
+// OnMetadataUpdate registers fn for METADATA_UPDATE notifications
+func (r *Router[T, R]) OnMetadataUpdate(fn HandlerFunc[T, R]) *Router[T, R] {
+	return r.On(TypeMetadataUpdate, "", fn)
+}
+
+// OnMigration registers fn for MIGRATION notifications
+func (r *Router[T, R]) OnMigration(fn HandlerFunc[T, R]) *Router[T, R] {
+	return r.On(TypeMigration, "", fn)
+}
+
+// OnOfferRedeemed registers fn for OFFER_REDEEMED notifications with subtype
+func (r *Router[T, R]) OnOfferRedeemed(subtype Subtype, fn HandlerFunc[T, R]) *Router[T, R] {
+	return r.On(TypeOfferRedeemed, subtype, fn)
+}
+
+// OnOneTimeCharge registers fn for ONE_TIME_CHARGE notifications
+func (r *Router[T, R]) OnOneTimeCharge(fn HandlerFunc[T, R]) *Router[T, R] {
+	return r.On(TypeOneTimeCharge, "", fn)
+}
+
+// OnPriceChange registers fn for PRICE_CHANGE notifications
+func (r *Router[T, R]) OnPriceChange(fn HandlerFunc[T, R]) *Router[T, R] {
+	return r.On(TypePriceChange, "", fn)
+}
+
+// OnPriceIncrease registers fn for PRICE_INCREASE notifications with subtype
+func (r *Router[T, R]) OnPriceIncrease(subtype Subtype, fn HandlerFunc[T, R]) *Router[T, R] {
+	return r.On(TypePriceIncrease, subtype, fn)
+}
+
+// OnRefund registers fn for REFUND notifications
+func (r *Router[T, R]) OnRefund(fn HandlerFunc[T, R]) *Router[T, R] {
+	return r.On(TypeRefund, "", fn)
+}
+
+// OnRefundDeclined registers fn for REFUND_DECLINED notifications
+func (r *Router[T, R]) OnRefundDeclined(fn HandlerFunc[T, R]) *Router[T, R] {
+	return r.On(TypeRefundDeclined, "", fn)
+}
+
+// OnRefundReversed registers fn for REFUND_REVERSED notifications
+func (r *Router[T, R]) OnRefundReversed(fn HandlerFunc[T, R]) *Router[T, R] {
+	return r.On(TypeRefundReversed, "", fn)
+}
+
+// OnRenewalExtended registers fn for RENEWAL_EXTENDED notifications
+func (r *Router[T, R]) OnRenewalExtended(fn HandlerFunc[T, R]) *Router[T, R] {
+	return r.On(TypeRenewalExtended, "", fn)
+}
+
+// OnRenewalExtension registers fn for RENEWAL_EXTENSION notifications with subtype
+func (r *Router[T, R]) OnRenewalExtension(subtype Subtype, fn HandlerFunc[T, R]) *Router[T, R] {
+	return r.On(TypeRenewalExtension, subtype, fn)
+}
+
+// OnSummary registers fn for RENEWAL_EXTENSION notifications with the SUMMARY subtype,
+// which carry DecodedPayload.Summary instead of Data
+func (r *Router[T, R]) OnSummary(fn HandlerFunc[T, R]) *Router[T, R] {
+	return r.On(TypeRenewalExtension, SubtypeSummary, fn)
+}
+
+// OnRevoke registers fn for REVOKE notifications
+func (r *Router[T, R]) OnRevoke(fn HandlerFunc[T, R]) *Router[T, R] {
+	return r.On(TypeRevoke, "", fn)
+}
+
+// OnSubscribed registers fn for SUBSCRIBED notifications with subtype
+func (r *Router[T, R]) OnSubscribed(subtype Subtype, fn HandlerFunc[T, R]) *Router[T, R] {
+	return r.On(TypeSubscribed, subtype, fn)
+}
+
+// OnTest registers fn for TEST notifications
+func (r *Router[T, R]) OnTest(fn HandlerFunc[T, R]) *Router[T, R] {
+	return r.On(TypeTest, "", fn)
+}
+
+// Handler returns the handler for payload, or nil if no handler matches
+func (r *Router[T, R]) Handler(payload *DecodedPayload) HandlerFunc[T, R] {
+	if fn, ok := r.routes[routeKey{notificationType: payload.NotificationType, subtype: payload.Subtype}]; ok {
+		return fn
+	}
+	if fn, ok := r.routes[routeKey{notificationType: payload.NotificationType}]; ok {
+		return fn
+	}
+	if !payload.NotificationType.IsKnown() && r.unknown != nil {
+		return r.unknown
+	}
+	return r.fallback
+}
+
+// Dispatch calls the handler matching payload, notifications without a handler are ignored
+func (r *Router[T, R]) Dispatch(ctx context.Context, payload *DecodedPayload, transaction T, renewalInfo R) error {
+	fn := r.Handler(payload)
+	if fn == nil {
+		return nil
+	}
+	return fn(ctx, payload, transaction, renewalInfo)
+}
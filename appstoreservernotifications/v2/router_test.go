@@ -0,0 +1,73 @@
+package appstoreservernotifications
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestRouterDispatch(t *testing.T) {
+	var called string
+	handler := func(name string) HandlerFunc[string, string] {
+		return func(ctx context.Context, payload *DecodedPayload, transaction string, renewalInfo string) error {
+			called = name + ":" + transaction + ":" + renewalInfo
+			return nil
+		}
+	}
+
+	router := NewRouter[string, string]().
+		OnSubscribed(SubtypeInitialBuy, handler("initialBuy")).
+		OnSubscribed("", handler("subscribed")).
+		OnRefund(handler("refund")).
+		OnDidFailToRenew(SubtypeGracePeriod, handler("gracePeriod")).
+		OnSummary(handler("summary")).
+		OnExternalPurchaseToken(handler("externalPurchaseToken")).
+		OnFallback(handler("fallback")).
+		OnUnknownType(handler("unknown"))
+
+	tests := []struct {
+		notificationType NotificationType
+		subtype          Subtype
+		want             string
+	}{
+		{TypeSubscribed, SubtypeInitialBuy, "initialBuy:t:r"},
+		{TypeSubscribed, SubtypeResubscribe, "subscribed:t:r"},
+		{TypeRefund, "", "refund:t:r"},
+		{TypeDidFailToRenew, SubtypeGracePeriod, "gracePeriod:t:r"},
+		{TypeDidFailToRenew, "", "fallback:t:r"},
+		{TypeRenewalExtension, SubtypeSummary, "summary:t:r"},
+		{TypeRenewalExtension, SubtypeFailure, "fallback:t:r"},
+		{TypeExternalPurchaseToken, SubtypeCreated, "externalPurchaseToken:t:r"},
+		{TypeTest, "", "fallback:t:r"},
+		{"NEW_TYPE", "", "unknown:t:r"},
+	}
+
+	for _, tt := range tests {
+		called = ""
+		payload := &DecodedPayload{NotificationType: tt.notificationType, Subtype: tt.subtype}
+		if err := router.Dispatch(context.Background(), payload, "t", "r"); err != nil {
+			t.Fatal(err)
+		}
+		if called != tt.want {
+			t.Fatalf("%s/%s: expected %q, got %q", tt.notificationType, tt.subtype, tt.want, called)
+		}
+	}
+}
+
+func TestRouterDispatchWithoutHandler(t *testing.T) {
+	wantErr := errors.New("failed")
+	router := NewRouter[string, string]().
+		OnRefund(func(ctx context.Context, payload *DecodedPayload, transaction string, renewalInfo string) error {
+			return wantErr
+		})
+
+	if err := router.Dispatch(context.Background(), &DecodedPayload{NotificationType: TypeRefund}, "", ""); !errors.Is(err, wantErr) {
+		t.Fatalf("expected %v, got %v", wantErr, err)
+	}
+	if err := router.Dispatch(context.Background(), &DecodedPayload{NotificationType: "NEW_TYPE"}, "", ""); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if router.Handler(&DecodedPayload{NotificationType: TypeTest}) != nil {
+		t.Fatal("expected no handler")
+	}
+}